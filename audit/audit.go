@@ -0,0 +1,192 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+audit contains the Command struct for repoman's "audit" subcommand.
+*/
+
+package audit
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/MultiMC/repoman/repoutil"
+	"github.com/MultiMC/repoman/subcmd"
+)
+
+// dateFormat is the format of --since and --until values that are just a date.
+const dateFormat = "2006-01-02"
+
+type Command struct {
+	since   string
+	until   string
+	chanId  string
+	version int
+}
+
+func (cmd Command) Summary() string { return "Shows who changed a repository, and how." }
+func (cmd Command) Description() string {
+	return "Lists the entries of the given repository's audit log, oldest first. Every command that changes the repository records when it was run, by which user on which machine, its arguments, and the hash of the resulting index. The options limit the entries to a date range, a channel, or a version."
+}
+func (cmd Command) Usage() string { return "REPO_DIR" }
+func (cmd Command) ArgHelp() string {
+	return "REPO_DIR - The repository directory to show the audit log of."
+}
+func (cmd *Command) SetFlags(flags *flag.FlagSet) {
+	flags.StringVar(&cmd.since, "since", "", "Only show changes made at or after `TIME`, in RFC 3339 format or as a date (e.g. 2013-11-05).")
+	flags.StringVar(&cmd.until, "until", "", "Only show changes made before `TIME`, in RFC 3339 format or as a date, which includes the whole day.")
+	flags.StringVar(&cmd.chanId, "channel", "", "Only show changes to the channel with the given `ID`.")
+	flags.IntVar(&cmd.version, "version", -1, "Only show changes that added, removed, or pointed a channel at or away from the version with the given `ID`.")
+}
+
+func (cmd Command) Execute(args ...string) subcmd.Error {
+	if len(args) < 1 {
+		return subcmd.UsageError("'audit' command requires one argument.")
+	}
+
+	filter := Filter{Channel: cmd.chanId, Version: cmd.version}
+	var err subcmd.Error
+	if filter.Since, err = parseTime("--since", cmd.since, false); err != nil {
+		return err
+	}
+	if filter.Until, err = parseTime("--until", cmd.until, true); err != nil {
+		return err
+	}
+
+	auditLog, err := GetLog(args[0], filter)
+	if err != nil {
+		return err
+	}
+	subcmd.PrintResult(auditLog)
+	return nil
+}
+
+// parseTime parses the value of the given time option. Blank values give the zero time.
+// A value that is just a date means the start of that day in the local time zone, or the start of the next day if end is true, so the whole day is included.
+func parseTime(option, value string, end bool) (time.Time, subcmd.Error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	day, err := time.ParseInLocation(dateFormat, value, time.Local)
+	if err != nil {
+		return time.Time{}, subcmd.UsageError(fmt.Sprintf("Invalid %s time '%s'. Times must be in RFC 3339 format (e.g. 2013-11-05T17:00:00Z) or dates (e.g. 2013-11-05).", option, value))
+	}
+	if end {
+		day = day.AddDate(0, 0, 1)
+	}
+	return day, nil
+}
+
+// Filter picks audit log entries. Blank fields, zero times, and a negative version match every entry.
+type Filter struct {
+	Since   time.Time
+	Until   time.Time
+	Channel string
+	Version int
+}
+
+// Matches returns true if the given entry is picked by the filter.
+func (filter Filter) Matches(entry repoutil.AuditEntry) bool {
+	if !filter.Since.IsZero() && entry.Time.Before(filter.Since) {
+		return false
+	}
+	if !filter.Until.IsZero() && !entry.Time.Before(filter.Until) {
+		return false
+	}
+	if filter.Channel != "" && !containsString(entry.Channels, filter.Channel) {
+		return false
+	}
+	if filter.Version >= 0 && !containsInt(entry.Versions, filter.Version) {
+		return false
+	}
+	return true
+}
+
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(list []int, value int) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// Log is a list of entries from a repository's audit log, oldest first.
+type Log struct {
+	Entries []repoutil.AuditEntry
+}
+
+// GetLog returns the entries of the given repository's audit log that match the given filter.
+func GetLog(repoDir string, filter Filter) (Log, subcmd.Error) {
+	errFmt := fmt.Sprintf("Can't show audit log for repository '%s': %%s", repoDir)
+	result := Log{Entries: []repoutil.AuditEntry{}}
+
+	if err := repoutil.CheckRepoDir(repoDir); err != nil {
+		return result, subcmd.WrapError(errFmt, err)
+	}
+
+	entries, err := repoutil.LoadAudit(repoDir)
+	if err != nil {
+		return result, subcmd.WrapError(errFmt, err)
+	}
+
+	for _, entry := range entries {
+		if filter.Matches(entry) {
+			result.Entries = append(result.Entries, entry)
+		}
+	}
+	return result, nil
+}
+
+// PrintText prints each entry as a line with its time, user, host, and command line, followed by an indented line with the resulting index hash and what changed.
+func (result Log) PrintText(w io.Writer) {
+	for _, entry := range result.Entries {
+		fmt.Fprintf(w, "%s  %s@%s  %s", entry.Time.Local().Format(time.RFC3339), entry.User, entry.Host, entry.Command)
+		for _, arg := range entry.Args {
+			if arg == "" || strings.ContainsAny(arg, " \t\n\"'") {
+				arg = fmt.Sprintf("%q", arg)
+			}
+			fmt.Fprintf(w, " %s", arg)
+		}
+		if entry.Client != "" {
+			fmt.Fprintf(w, "  (from %s)", entry.Client)
+		}
+		fmt.Fprintln(w)
+
+		fmt.Fprintf(w, "    index %s", entry.IndexHash)
+		if len(entry.Channels) > 0 {
+			fmt.Fprintf(w, ", channels %s", strings.Join(entry.Channels, " "))
+		}
+		if len(entry.Versions) > 0 {
+			fmt.Fprintf(w, ", versions %s", strings.Trim(fmt.Sprint(entry.Versions), "[]"))
+		}
+		fmt.Fprintln(w)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package audit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MultiMC/repoman/repoutil"
+)
+
+func TestFilterMatches(t *testing.T) {
+	entry := repoutil.AuditEntry{
+		Time:     time.Date(2013, 11, 5, 17, 0, 0, 0, time.UTC),
+		Channels: []string{"beta", "stable"},
+		Versions: []int{3, 4},
+	}
+	day := time.Date(2013, 11, 5, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		desc   string
+		filter Filter
+		want   bool
+	}{
+		{"everything", Filter{Version: -1}, true},
+		{"since before", Filter{Since: day, Version: -1}, true},
+		{"since exactly", Filter{Since: entry.Time, Version: -1}, true},
+		{"since after", Filter{Since: entry.Time.Add(time.Second), Version: -1}, false},
+		{"until after", Filter{Until: day.AddDate(0, 0, 1), Version: -1}, true},
+		{"until exactly", Filter{Until: entry.Time, Version: -1}, false},
+		{"channel", Filter{Channel: "stable", Version: -1}, true},
+		{"other channel", Filter{Channel: "dev", Version: -1}, false},
+		{"version", Filter{Version: 4}, true},
+		{"version zero", Filter{Version: 0}, false},
+		{"other version", Filter{Version: 5}, false},
+		{"all match", Filter{Since: day, Until: day.AddDate(0, 0, 1), Channel: "beta", Version: 3}, true},
+		{"one doesn't match", Filter{Since: day, Until: day.AddDate(0, 0, 1), Channel: "beta", Version: 5}, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			if got := test.filter.Matches(entry); got != test.want {
+				t.Errorf("Matches(%+v) = %v, want %v", entry, got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	tests := []struct {
+		value string
+		end   bool
+		want  time.Time
+	}{
+		{"", false, time.Time{}},
+		{"", true, time.Time{}},
+		{"2013-11-05T17:00:00Z", false, time.Date(2013, 11, 5, 17, 0, 0, 0, time.UTC)},
+		{"2013-11-05T17:00:00Z", true, time.Date(2013, 11, 5, 17, 0, 0, 0, time.UTC)},
+		{"2013-11-05T17:00:00+02:00", false, time.Date(2013, 11, 5, 15, 0, 0, 0, time.UTC)},
+		{"2013-11-05", false, time.Date(2013, 11, 5, 0, 0, 0, 0, time.Local)},
+		{"2013-11-05", true, time.Date(2013, 11, 6, 0, 0, 0, 0, time.Local)},
+		{"2013-12-31", true, time.Date(2014, 1, 1, 0, 0, 0, 0, time.Local)},
+	}
+
+	for _, test := range tests {
+		got, err := parseTime("--since", test.value, test.end)
+		if err != nil {
+			t.Errorf("parseTime(%q, %v) returned error: %s", test.value, test.end, err)
+		} else if !got.Equal(test.want) {
+			t.Errorf("parseTime(%q, %v) = %s, want %s", test.value, test.end, got, test.want)
+		}
+	}
+
+	for _, value := range []string{"yesterday", "2013-13-01", "2013-11-05 17:00", "11/05/2013"} {
+		if _, err := parseTime("--until", value, false); err == nil || !err.ShowUsage() {
+			t.Errorf("parseTime(%q) returned %v, want a usage error", value, err)
+		}
+	}
+}
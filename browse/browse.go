@@ -0,0 +1,222 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+browse renders static HTML pages for browsing a repository, and contains the Command struct for repoman's "browse" subcommand.
+*/
+
+package browse
+
+import (
+	"flag"
+	"fmt"
+	"html/template"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/MultiMC/repoman/config"
+	"github.com/MultiMC/repoman/repoutil"
+	"github.com/MultiMC/repoman/subcmd"
+)
+
+// BrowseDirName is the name of the directory in the repository directory that the browse pages are written to.
+const BrowseDirName = "browse"
+
+// RenderFailedExitCode is the exit code used when the browse pages couldn't be rendered.
+const RenderFailedExitCode = 61
+
+type Command struct{}
+
+func (cmd Command) Summary() string { return "Renders static HTML pages for browsing a repository." }
+func (cmd Command) Description() string {
+	return "Renders a channel overview, a version list, and a file listing for each version as static HTML pages in the browse directory of the given repository. Once the pages exist, commands that change the repository keep them up to date."
+}
+func (cmd Command) Usage() string { return "REPO_DIR [FILE_STORAGE]" }
+func (cmd Command) ArgHelp() string {
+	return "REPO_DIR - The repository directory to render pages for.\nFILE_STORAGE - Optional path to the repository's file storage directory. If specified or configured, file sizes are shown in the file listings."
+}
+func (cmd Command) SetFlags(flags *flag.FlagSet) { repoutil.AddDryRunFlag(flags) }
+
+func (cmd Command) Execute(args ...string) subcmd.Error {
+	if len(args) < 1 {
+		return subcmd.UsageError("'browse' command requires at least one argument.")
+	} else {
+		filesArg := ""
+		if len(args) >= 2 {
+			filesArg = args[1]
+		}
+		filesDir, err := config.StorageDir(args[0], filesArg)
+		if err != nil {
+			return err
+		}
+		return repoutil.FinishChange(args[0], repoutil.WithLock(args[0], func() subcmd.Error {
+			return Render(args[0], filesDir, true)
+		}))
+	}
+}
+
+// Enabled returns true if the given repository has browse pages that should be kept up to date.
+func Enabled(repoDir string) bool {
+	info, err := os.Stat(path.Join(repoDir, BrowseDirName))
+	return err == nil && info.IsDir()
+}
+
+// VersionPagePath returns the path, relative to the repository directory, of the file listing page for the given version.
+func VersionPagePath(versionId int) string {
+	return path.Join(BrowseDirName, "versions", fmt.Sprintf("%d.html", versionId))
+}
+
+type channelRow struct {
+	Id          string
+	Name        string
+	Description string
+	Version     int
+	VersionName string
+	Rollout     *repoutil.Rollout
+}
+
+type versionRow struct {
+	Id       int
+	Name     string
+	Released string
+	Summary  string
+	Channels []string
+}
+
+type fileRow struct {
+	Path  string
+	Size  string
+	MD5   string
+	Perms string
+}
+
+type versionPage struct {
+	Id       int
+	Name     string
+	Released string
+	Commit   string
+	Notes    string
+	Build    map[string]string
+	Files    []fileRow
+	Total    string
+}
+
+// Render writes the browse pages for the given repository. If filesDir isn't blank, it is used to look up file sizes.
+// The channel overview and version list are always rewritten. Since versions never change once they've been added, version pages are only written if they don't exist yet, unless allVersions is true.
+func Render(repoDir, filesDir string, allVersions bool) subcmd.Error {
+	errFmt := fmt.Sprintf("Failed to render browse pages for repository '%s': %%s", repoDir)
+
+	indexData, err := repoutil.LoadIndex(repoDir)
+	if err != nil {
+		return subcmd.WrapError(errFmt, err)
+	}
+
+	if repoutil.DryRun {
+		repoutil.DryRunf("render the browse pages in %s.", BrowseDirName)
+		return nil
+	}
+
+	if mkErr := os.MkdirAll(path.Join(repoDir, BrowseDirName, "versions"), 0755); mkErr != nil {
+		return subcmd.CausedError(fmt.Sprintf(errFmt, "Couldn't create the browse directory."), RenderFailedExitCode, mkErr)
+	}
+
+	names := map[int]string{}
+	onChannels := map[int][]string{}
+	for _, version := range indexData.Versions {
+		names[version.Id] = version.Name
+	}
+
+	channels := []channelRow{}
+	for _, channel := range indexData.Channels {
+		row := channelRow{Id: channel.Id, Name: channel.Name, Description: indexData.ChannelInfo[channel.Id].Description, Version: channel.CurrentVersion, VersionName: names[channel.CurrentVersion]}
+		if rollout, ok := indexData.Rollouts[channel.Id]; ok {
+			row.Rollout = &rollout
+		}
+		channels = append(channels, row)
+		onChannels[channel.CurrentVersion] = append(onChannels[channel.CurrentVersion], channel.Id)
+	}
+
+	versions := []versionRow{}
+	for _, version := range indexData.Versions {
+		info := indexData.VersionInfo[version.Id]
+		versions = append(versions, versionRow{Id: version.Id, Name: version.Name, Released: formatTime(info.ReleaseTime), Summary: info.Summary, Channels: onChannels[version.Id]})
+	}
+	// Newest versions first.
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Id > versions[j].Id })
+
+	if err := writePage(repoDir, path.Join(BrowseDirName, "index.html"), channelsTemplate, channels); err != nil {
+		return subcmd.WrapError(errFmt, err)
+	}
+	if err := writePage(repoDir, path.Join(BrowseDirName, "versions.html"), versionsTemplate, versions); err != nil {
+		return subcmd.WrapError(errFmt, err)
+	}
+
+	for _, version := range indexData.Versions {
+		pagePath := VersionPagePath(version.Id)
+		if _, statErr := os.Stat(path.Join(repoDir, pagePath)); statErr == nil && !allVersions {
+			continue
+		}
+
+		versionData, err := repoutil.LoadVersion(repoDir, version.Id)
+		if err != nil {
+			return subcmd.WrapError(errFmt, err)
+		}
+
+		page := versionPage{Id: versionData.Id, Name: versionData.Name, Released: formatTime(versionData.ReleaseTime), Commit: versionData.Commit, Notes: versionData.ReleaseNotes, Build: versionData.Build}
+		total := int64(0)
+		for _, file := range versionData.Files {
+			size := int64(-1)
+			if filesDir != "" {
+				size = repoutil.StoredFileSize(filesDir, file)
+			}
+			if size > 0 {
+				total += size
+			}
+			page.Files = append(page.Files, fileRow{Path: file.Path, Size: repoutil.FormatSize(size), MD5: file.MD5, Perms: os.FileMode(file.Perms).String()})
+		}
+		sort.Slice(page.Files, func(i, j int) bool { return page.Files[i].Path < page.Files[j].Path })
+		if filesDir != "" {
+			page.Total = repoutil.FormatSize(total)
+		}
+
+		if err := writePage(repoDir, pagePath, versionTemplate, page); err != nil {
+			return subcmd.WrapError(errFmt, err)
+		}
+	}
+
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format("2006-01-02 15:04 MST")
+}
+
+// writePage renders the given template with the given data to the given path relative to the repository directory.
+func writePage(repoDir, pagePath string, tmpl *template.Template, data interface{}) subcmd.Error {
+	file, err := os.Create(path.Join(repoDir, pagePath))
+	if err != nil {
+		return subcmd.CausedError(fmt.Sprintf("Couldn't create %s.", pagePath), RenderFailedExitCode, err)
+	}
+	defer file.Close()
+
+	if err := tmpl.Execute(file, data); err != nil {
+		return subcmd.CausedError(fmt.Sprintf("Couldn't render %s.", pagePath), RenderFailedExitCode, err)
+	}
+	return nil
+}
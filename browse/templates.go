@@ -0,0 +1,92 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package browse
+
+import (
+	"html/template"
+)
+
+// The header and footer are shared by every page. Pages set "root" to the relative path of the browse directory.
+const layout = `
+{{define "header"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; }
+th, td { text-align: left; padding: 0.2em 1em 0.2em 0; vertical-align: top; }
+td.mono { font-family: monospace; }
+pre { background: #f4f4f4; padding: 1em; white-space: pre-wrap; }
+</style>
+</head>
+<body>
+{{end}}
+{{define "footer"}}</body>
+</html>
+{{end}}
+`
+
+var channelsTemplate = template.Must(template.Must(template.New("channels").Parse(layout)).Parse(`{{template "header" "Channels"}}
+<h1>Channels</h1>
+<p><a href="versions.html">All versions</a></p>
+<table>
+<tr><th>Channel</th><th>Name</th><th>Current version</th><th>Rollout</th><th>Description</th></tr>
+{{range .}}<tr>
+<td>{{.Id}}</td>
+<td>{{.Name}}</td>
+<td><a href="versions/{{.Version}}.html">{{.VersionName}}</a> ({{.Version}})</td>
+<td>{{with .Rollout}}<a href="versions/{{.NewVersion}}.html">{{.NewVersion}}</a> to {{.Percentage}}%{{if .Paused}} (paused){{end}}{{end}}</td>
+<td>{{.Description}}</td>
+</tr>
+{{end}}</table>
+{{template "footer"}}`))
+
+var versionsTemplate = template.Must(template.Must(template.New("versions").Parse(layout)).Parse(`{{template "header" "Versions"}}
+<h1>Versions</h1>
+<p><a href="index.html">Channels</a></p>
+<table>
+<tr><th>ID</th><th>Name</th><th>Released</th><th>Channels</th><th>Summary</th></tr>
+{{range .}}<tr>
+<td>{{.Id}}</td>
+<td><a href="versions/{{.Id}}.html">{{.Name}}</a></td>
+<td>{{.Released}}</td>
+<td>{{range $i, $c := .Channels}}{{if $i}}, {{end}}{{$c}}{{end}}</td>
+<td>{{.Summary}}</td>
+</tr>
+{{end}}</table>
+{{template "footer"}}`))
+
+var versionTemplate = template.Must(template.Must(template.New("version").Parse(layout)).Parse(`{{template "header" .Name}}
+<h1>Version {{.Name}} ({{.Id}})</h1>
+<p><a href="../index.html">Channels</a> | <a href="../versions.html">All versions</a></p>
+{{if .Released}}<p>Released {{.Released}}</p>{{end}}
+{{if .Commit}}<p>Commit <code>{{.Commit}}</code></p>{{end}}
+{{if .Build}}<table>{{range $k, $v := .Build}}<tr><th>{{$k}}</th><td>{{$v}}</td></tr>{{end}}</table>{{end}}
+{{if .Notes}}<h2>Release notes</h2>
+<pre>{{.Notes}}</pre>{{end}}
+<h2>Files</h2>
+<table>
+<tr><th>Path</th><th>Size</th><th>Permissions</th><th>MD5</th></tr>
+{{range .Files}}<tr>
+<td>{{.Path}}</td>
+<td>{{.Size}}</td>
+<td class="mono">{{.Perms}}</td>
+<td class="mono">{{.MD5}}</td>
+</tr>
+{{end}}</table>
+{{with .Total}}<p>Total size: {{.}}</p>{{end}}
+{{template "footer"}}`))
@@ -0,0 +1,106 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+chanlog contains the Command struct for repoman's "chanlog" subcommand.
+*/
+
+package chanlog
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/MultiMC/repoman/repoutil"
+	"github.com/MultiMC/repoman/subcmd"
+)
+
+type Command struct{}
+
+func (cmd Command) Summary() string { return "Shows the history of a repository's channels." }
+func (cmd Command) Description() string {
+	return "Lists every recorded change to the channels in the given repository, oldest first, including who made the change and why. If a channel ID is given, only that channel's changes are shown."
+}
+func (cmd Command) Usage() string { return "REPO_DIR [CHANNEL_ID]" }
+func (cmd Command) ArgHelp() string {
+	return "REPO_DIR - The repository directory to show the channel history of.\nCHANNEL_ID - Optional ID of the channel to show the history of. If not specified, all channels are shown."
+}
+
+func (cmd Command) Execute(args ...string) subcmd.Error {
+	if len(args) < 1 {
+		return subcmd.UsageError("'chanlog' command requires at least one argument.")
+	} else {
+		chanId := ""
+		if len(args) >= 2 {
+			chanId = args[1]
+		}
+		history, err := GetHistory(args[0], chanId)
+		if err != nil {
+			return err
+		}
+		subcmd.PrintResult(history)
+		return nil
+	}
+}
+
+// History is a list of changes from a repository's channel history, oldest first.
+type History struct {
+	Changes []repoutil.ChannelChange
+}
+
+// GetHistory returns the channel history of the given repository. If chanId isn't blank, only changes to that channel are returned.
+func GetHistory(repoDir, chanId string) (History, subcmd.Error) {
+	errFmt := fmt.Sprintf("Can't show channel history for repository '%s': %%s", repoDir)
+	result := History{Changes: []repoutil.ChannelChange{}}
+
+	if err := repoutil.CheckRepoDir(repoDir); err != nil {
+		return result, subcmd.WrapError(errFmt, err)
+	}
+
+	history, err := repoutil.LoadHistory(repoDir)
+	if err != nil {
+		return result, subcmd.WrapError(errFmt, err)
+	}
+
+	for _, change := range history {
+		if chanId == "" || change.Channel == chanId {
+			result.Changes = append(result.Changes, change)
+		}
+	}
+	return result, nil
+}
+
+// PrintText prints each change on its own line.
+func (result History) PrintText(w io.Writer) {
+	for _, change := range result.Changes {
+		var what string
+		switch {
+		case change.OldVersion < 0:
+			what = fmt.Sprintf("created at %d", change.NewVersion)
+		case change.NewVersion < 0:
+			what = fmt.Sprintf("removed from %d", change.OldVersion)
+		case change.Rollback:
+			what = fmt.Sprintf("%d -> %d (rollback)", change.OldVersion, change.NewVersion)
+		default:
+			what = fmt.Sprintf("%d -> %d", change.OldVersion, change.NewVersion)
+		}
+
+		fmt.Fprintf(w, "%s  %-12s %-20s by %s", change.Time.Local().Format(time.RFC3339), change.Channel, what, change.User)
+		if change.Reason != "" {
+			fmt.Fprintf(w, ": %s", change.Reason)
+		}
+		fmt.Fprintln(w)
+	}
+}
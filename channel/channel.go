@@ -0,0 +1,301 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+channel contains the Command structs for repoman's channel management subcommands: "mkchan", "editchan", "renamechan", and "rmchan".
+*/
+
+package channel
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+
+	"github.com/MultiMC/repoman/publish"
+	"github.com/MultiMC/repoman/repoutil"
+	"github.com/MultiMC/repoman/subcmd"
+
+	"github.com/MultiMC/GoUpdate/repo"
+)
+
+//////////////////////////////
+/////// MKCHAN COMMAND ///////
+//////////////////////////////
+
+type CreateCommand struct{}
+
+func (cmd CreateCommand) Summary() string { return "Creates a new channel in a repository." }
+func (cmd CreateCommand) Description() string {
+	return "Creates a new channel with the given ID, display name, and optional description in the given repository and points it at the given version. Fails if a channel with the given ID already exists."
+}
+func (cmd CreateCommand) Usage() string {
+	return "REPO_DIR CHANNEL_ID VERSION_ID NAME [DESCRIPTION]"
+}
+func (cmd CreateCommand) ArgHelp() string {
+	return "REPO_DIR - The repository directory to create the channel in.\nCHANNEL_ID - Unique string ID of the channel to create.\nVERSION_ID - The ID of the version the channel should point at.\nNAME - The channel's display name.\nDESCRIPTION - Optional description of the channel."
+}
+func (cmd CreateCommand) SetFlags(flags *flag.FlagSet) {
+	repoutil.AddDryRunFlag(flags)
+	publish.AddPurgeListFlag(flags)
+}
+
+func (cmd CreateCommand) Execute(args ...string) subcmd.Error {
+	if len(args) < 4 {
+		return subcmd.UsageError("'mkchan' command requires at least four arguments.")
+	} else {
+		versionId, err := strconv.ParseInt(args[2], 10, 0)
+		if err != nil || versionId < 0 {
+			return subcmd.UsageError("Version ID must be a positive integer.")
+		}
+
+		description := ""
+		if len(args) >= 5 {
+			description = args[4]
+		}
+
+		return repoutil.ChangeChannel(args[0], args[1], func() subcmd.Error {
+			return CreateChannel(args[0], args[1], int(versionId), args[3], description)
+		})
+	}
+}
+
+// CreateChannel adds a new channel with the given information to the given repository.
+func CreateChannel(repoDir, chanId string, versionId int, name, description string) subcmd.Error {
+	errFmt := fmt.Sprintf("Can't create channel '%s' in repository '%s': %%s", chanId, repoDir)
+
+	if err := repoutil.CheckChannelId(chanId); err != nil {
+		return subcmd.WrapError(errFmt, err)
+	}
+
+	indexData, err := repoutil.LoadIndex(repoDir)
+	if err != nil {
+		return subcmd.WrapError(errFmt, err)
+	}
+
+	if indexData.FindChannel(chanId) >= 0 {
+		return subcmd.MessageError(fmt.Sprintf(errFmt, "A channel with that ID already exists."), 46)
+	}
+
+	indexData.Channels = append(indexData.Channels, repo.Channel{Id: chanId, Name: name, CurrentVersion: versionId})
+	if description != "" {
+		indexData.ChannelInfo[chanId] = repoutil.ChannelInfo{Description: description}
+	}
+
+	if err := publish.WriteIndex(repoDir, indexData); err != nil {
+		return subcmd.WrapError(errFmt, err)
+	}
+
+	if err := repoutil.RecordChannelChange(repoDir, repoutil.ChannelChange{Channel: chanId, OldVersion: -1, NewVersion: versionId, Reason: "Channel created."}); err != nil {
+		return subcmd.WrapError(errFmt, err)
+	}
+	return publish.Refresh(repoDir, "")
+}
+
+//////////////////////////////
+////// EDITCHAN COMMAND //////
+//////////////////////////////
+
+type EditCommand struct{}
+
+func (cmd EditCommand) Summary() string {
+	return "Changes a channel's display name and description."
+}
+func (cmd EditCommand) Description() string {
+	return "Changes the display name of the given channel and, if one is given, its description. Pass an empty string as the description to remove it."
+}
+func (cmd EditCommand) Usage() string { return "REPO_DIR CHANNEL_ID NAME [DESCRIPTION]" }
+func (cmd EditCommand) ArgHelp() string {
+	return "REPO_DIR - The repository directory containing the channel.\nCHANNEL_ID - The ID of the channel to edit.\nNAME - The channel's new display name.\nDESCRIPTION - Optional new description for the channel. If not specified, the description is left unchanged."
+}
+func (cmd EditCommand) SetFlags(flags *flag.FlagSet) {
+	repoutil.AddDryRunFlag(flags)
+	publish.AddPurgeListFlag(flags)
+}
+
+func (cmd EditCommand) Execute(args ...string) subcmd.Error {
+	if len(args) < 3 {
+		return subcmd.UsageError("'editchan' command requires at least three arguments.")
+	} else {
+		var description *string
+		if len(args) >= 4 {
+			description = &args[3]
+		}
+		return repoutil.ChangeChannel(args[0], args[1], func() subcmd.Error {
+			return EditChannel(args[0], args[1], args[2], description)
+		})
+	}
+}
+
+// EditChannel sets the display name of the given channel and, if description isn't nil, its description.
+func EditChannel(repoDir, chanId, name string, description *string) subcmd.Error {
+	errFmt := fmt.Sprintf("Can't edit channel '%s' in repository '%s': %%s", chanId, repoDir)
+
+	indexData, err := repoutil.LoadIndex(repoDir)
+	if err != nil {
+		return subcmd.WrapError(errFmt, err)
+	}
+
+	i := indexData.FindChannel(chanId)
+	if i < 0 {
+		return subcmd.MessageError(fmt.Sprintf(errFmt, "No such channel."), 16)
+	}
+
+	indexData.Channels[i].Name = name
+	if description != nil {
+		if *description == "" {
+			delete(indexData.ChannelInfo, chanId)
+		} else {
+			info := indexData.ChannelInfo[chanId]
+			info.Description = *description
+			indexData.ChannelInfo[chanId] = info
+		}
+	}
+
+	if err := publish.WriteIndex(repoDir, indexData); err != nil {
+		return subcmd.WrapError(errFmt, err)
+	}
+	return publish.Refresh(repoDir, "")
+}
+
+//////////////////////////////
+///// RENAMECHAN COMMAND /////
+//////////////////////////////
+
+type RenameCommand struct{}
+
+func (cmd RenameCommand) Summary() string { return "Changes a channel's ID." }
+func (cmd RenameCommand) Description() string {
+	return "Changes the ID of the given channel, keeping its current version, display name, description, and any rollout in progress. Clients that are following the old ID will no longer find the channel."
+}
+func (cmd RenameCommand) Usage() string { return "REPO_DIR CHANNEL_ID NEW_CHANNEL_ID" }
+func (cmd RenameCommand) ArgHelp() string {
+	return "REPO_DIR - The repository directory containing the channel.\nCHANNEL_ID - The channel's current ID.\nNEW_CHANNEL_ID - The ID to give the channel. No other channel may have this ID."
+}
+func (cmd RenameCommand) SetFlags(flags *flag.FlagSet) {
+	repoutil.AddDryRunFlag(flags)
+	publish.AddPurgeListFlag(flags)
+}
+
+func (cmd RenameCommand) Execute(args ...string) subcmd.Error {
+	if len(args) < 3 {
+		return subcmd.UsageError("'renamechan' command requires three arguments.")
+	} else {
+		return repoutil.ChangeChannel(args[0], args[2], func() subcmd.Error {
+			return RenameChannel(args[0], args[1], args[2])
+		})
+	}
+}
+
+// RenameChannel changes the ID of the given channel.
+func RenameChannel(repoDir, chanId, newChanId string) subcmd.Error {
+	errFmt := fmt.Sprintf("Can't rename channel '%s' to '%s' in repository '%s': %%s", chanId, newChanId, repoDir)
+
+	if err := repoutil.CheckChannelId(newChanId); err != nil {
+		return subcmd.WrapError(errFmt, err)
+	}
+
+	indexData, err := repoutil.LoadIndex(repoDir)
+	if err != nil {
+		return subcmd.WrapError(errFmt, err)
+	}
+
+	i := indexData.FindChannel(chanId)
+	if i < 0 {
+		return subcmd.MessageError(fmt.Sprintf(errFmt, "No such channel."), 16)
+	}
+	if indexData.FindChannel(newChanId) >= 0 {
+		return subcmd.MessageError(fmt.Sprintf(errFmt, "A channel with the new ID already exists."), 46)
+	}
+
+	indexData.Channels[i].Id = newChanId
+	if info, ok := indexData.ChannelInfo[chanId]; ok {
+		delete(indexData.ChannelInfo, chanId)
+		indexData.ChannelInfo[newChanId] = info
+	}
+	if rollout, ok := indexData.Rollouts[chanId]; ok {
+		delete(indexData.Rollouts, chanId)
+		indexData.Rollouts[newChanId] = rollout
+	}
+
+	if err := publish.WriteIndex(repoDir, indexData); err != nil {
+		return subcmd.WrapError(errFmt, err)
+	}
+
+	if err := repoutil.RenameChannelHistory(repoDir, chanId, newChanId); err != nil {
+		return subcmd.WrapError(errFmt, err)
+	}
+	return publish.Refresh(repoDir, "")
+}
+
+//////////////////////////////
+/////// RMCHAN COMMAND ///////
+//////////////////////////////
+
+type DeleteCommand struct{}
+
+func (cmd DeleteCommand) Summary() string { return "Removes a channel from a repository." }
+func (cmd DeleteCommand) Description() string {
+	return "Removes the given channel from the given repository. The versions it pointed at are not affected."
+}
+func (cmd DeleteCommand) Usage() string { return "REPO_DIR CHANNEL_ID" }
+func (cmd DeleteCommand) ArgHelp() string {
+	return "REPO_DIR - The repository directory containing the channel.\nCHANNEL_ID - The ID of the channel to remove."
+}
+func (cmd DeleteCommand) SetFlags(flags *flag.FlagSet) {
+	repoutil.AddDryRunFlag(flags)
+	publish.AddPurgeListFlag(flags)
+}
+
+func (cmd DeleteCommand) Execute(args ...string) subcmd.Error {
+	if len(args) < 2 {
+		return subcmd.UsageError("'rmchan' command requires two arguments.")
+	} else {
+		return repoutil.ChangeChannel(args[0], args[1], func() subcmd.Error {
+			return DeleteChannel(args[0], args[1])
+		})
+	}
+}
+
+// DeleteChannel removes the given channel from the given repository.
+func DeleteChannel(repoDir, chanId string) subcmd.Error {
+	errFmt := fmt.Sprintf("Can't remove channel '%s' from repository '%s': %%s", chanId, repoDir)
+
+	indexData, err := repoutil.LoadIndex(repoDir)
+	if err != nil {
+		return subcmd.WrapError(errFmt, err)
+	}
+
+	i := indexData.FindChannel(chanId)
+	if i < 0 {
+		return subcmd.MessageError(fmt.Sprintf(errFmt, "No such channel."), 16)
+	}
+
+	// Removing from a slice is messy, but this works.
+	// Basically, it splits the slice into two parts, the first half being everything before the index to remove and the second half being everything after the index to remove.
+	// Then, just append those two together.
+	oldVersionId := indexData.Channels[i].CurrentVersion
+	indexData.Channels = append(indexData.Channels[:i], indexData.Channels[i+1:]...)
+	delete(indexData.ChannelInfo, chanId)
+	delete(indexData.Rollouts, chanId)
+
+	if err := publish.WriteIndex(repoDir, indexData); err != nil {
+		return subcmd.WrapError(errFmt, err)
+	}
+
+	if err := repoutil.RecordChannelChange(repoDir, repoutil.ChannelChange{Channel: chanId, OldVersion: oldVersionId, NewVersion: -1, Reason: "Channel removed."}); err != nil {
+		return subcmd.WrapError(errFmt, err)
+	}
+	return publish.Refresh(repoDir, "")
+}
@@ -0,0 +1,311 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+completion contains the Command structs for repoman's "completion" subcommand, which prints shell completion scripts, and the hidden "__complete" subcommand those scripts call to get completions.
+*/
+
+package completion
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/MultiMC/repoman/repoutil"
+	"github.com/MultiMC/repoman/subcmd"
+)
+
+// FilesDirective is printed by the __complete command instead of any candidates when the shell should complete file names.
+const FilesDirective = ":files"
+
+type Command struct {
+	// Commands is RepoMan's command registry, which completions are generated from.
+	Commands map[string]subcmd.Command
+}
+
+func (cmd Command) Summary() string {
+	return "Prints a shell completion script for bash, zsh, or fish."
+}
+func (cmd Command) Description() string {
+	return "Prints a script that sets up completion of RepoMan's commands, options, and arguments for the given shell. Channel IDs and version IDs are completed by reading the index of the repository given as the REPO_DIR argument. For example, add 'source <(repoman completion bash)' to ~/.bashrc, run 'repoman completion zsh > \"${fpath[1]}/_repoman\"', or run 'repoman completion fish > ~/.config/fish/completions/repoman.fish'."
+}
+func (cmd Command) Usage() string { return "bash|zsh|fish" }
+func (cmd Command) ArgHelp() string {
+	return "bash|zsh|fish - The shell to print a completion script for."
+}
+
+func (cmd Command) Execute(args ...string) subcmd.Error {
+	if len(args) < 1 {
+		return subcmd.UsageError("'completion' command requires one argument.")
+	}
+
+	script, ok := scripts[args[0]]
+	if !ok {
+		return subcmd.UsageError(fmt.Sprintf("Unknown shell '%s'.", args[0]))
+	}
+	fmt.Print(strings.Replace(script, "PROG", filepath.Base(os.Args[0]), -1))
+	return nil
+}
+
+// CompleteCommand prints the completions for a partly typed command line. It is called by the completion scripts and isn't meant to be run by hand.
+// The scripts pass "--" before the words so options in them aren't parsed as options of __complete itself.
+type CompleteCommand struct {
+	Commands map[string]subcmd.Command
+}
+
+func (cmd CompleteCommand) Summary() string { return "Prints completions for the completion scripts." }
+func (cmd CompleteCommand) Description() string {
+	return "Prints the possible completions of the last of the given words, one per line. The words are a RepoMan command line without the program name. If file names should be completed, prints " + FilesDirective + " instead."
+}
+func (cmd CompleteCommand) Usage() string { return "[WORD...]" }
+func (cmd CompleteCommand) ArgHelp() string {
+	return "WORD - The words typed so far. The last is the one being completed."
+}
+
+func (cmd CompleteCommand) Execute(args ...string) subcmd.Error {
+	for _, candidate := range Complete(cmd.Commands, args) {
+		fmt.Println(candidate)
+	}
+	return nil
+}
+
+// Complete returns the possible completions of the last of the given words, which are a RepoMan command line without the program name.
+// If file names should be completed, it returns just FilesDirective.
+func Complete(commands map[string]subcmd.Command, words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	current := words[len(words)-1]
+	words = words[:len(words)-1]
+
+	// Skip the global options.
+	for len(words) > 0 {
+		if words[0] == "--config" || words[0] == "--output" || words[0] == "--log-file" {
+			if len(words) == 1 {
+				return optionValues(words[0], current)
+			}
+			words = words[2:]
+		} else if strings.HasPrefix(words[0], "--config=") || strings.HasPrefix(words[0], "--output=") || strings.HasPrefix(words[0], "--log-file=") || isVerbosityOption(words[0]) {
+			words = words[1:]
+		} else {
+			break
+		}
+	}
+
+	// The first word is the command.
+	if len(words) == 0 {
+		return filter(commandNames(commands), current)
+	}
+	cmd, ok := commands[words[0]]
+	if !ok {
+		return nil
+	}
+	flags := subcmd.NewFlagSet(words[0], cmd)
+
+	// Separate the arguments from the options, noting which option the word being completed is the value of, if any.
+	args := []string{}
+	optionValue := ""
+	for i := 1; i < len(words); i++ {
+		word := words[i]
+		if word == "--" {
+			args = append(args, words[i+1:]...)
+			break
+		}
+		if len(word) > 1 && strings.HasPrefix(word, "-") && !strings.Contains(word, "=") {
+			if takesValue(flags, strings.TrimLeft(word, "-")) {
+				if i == len(words)-1 {
+					optionValue = word
+				}
+				i++
+			}
+			continue
+		} else if len(word) > 1 && strings.HasPrefix(word, "-") {
+			continue
+		}
+		args = append(args, word)
+	}
+
+	switch {
+	case optionValue != "":
+		return optionValues(optionValue, current)
+	case strings.HasPrefix(current, "-") && current != "-":
+		return filter(flagNames(flags), current)
+	}
+
+	repoDir := ""
+	tokens := usageTokens(cmd.Usage())
+	if len(tokens) > 0 && tokens[0] == "REPO_DIR" && len(args) > 0 {
+		repoDir = args[0]
+	}
+	return filter(argCandidates(commands, tokens, args, repoDir), current)
+}
+
+// commandNames returns the names of the commands in the registry that aren't hidden, in alphabetical order.
+func commandNames(commands map[string]subcmd.Command) []string {
+	names := []string{}
+	for name := range commands {
+		if !subcmd.Hidden(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// flagNames returns the names of the options in the given flag set, with two dashes in front.
+func flagNames(flags *flag.FlagSet) []string {
+	names := []string{"--help"}
+	flags.VisitAll(func(f *flag.Flag) {
+		names = append(names, "--"+f.Name)
+	})
+	return names
+}
+
+// takesValue returns true if the option with the given name takes a value as the next argument.
+func takesValue(flags *flag.FlagSet, name string) bool {
+	f := flags.Lookup(name)
+	if f == nil {
+		return false
+	}
+	if boolFlag, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && boolFlag.IsBoolFlag() {
+		return false
+	}
+	return true
+}
+
+// isVerbosityOption returns true if the given word is one of the global -v and -q options.
+func isVerbosityOption(word string) bool {
+	switch word {
+	case "-v", "--v", "-verbose", "--verbose", "-q", "--q", "-quiet", "--quiet":
+		return true
+	}
+	return false
+}
+
+// optionValues returns the possible values of the given option. Only --output has a fixed set of values; anything else is completed as a file name.
+func optionValues(option, current string) []string {
+	if strings.TrimLeft(option, "-") == "output" {
+		return filter([]string{subcmd.TextOutput, subcmd.JSONOutput}, current)
+	}
+	return []string{FilesDirective}
+}
+
+// usageTokens splits a command's Usage string into the names of its arguments, without the brackets around optional ones.
+func usageTokens(usage string) []string {
+	return strings.Fields(strings.NewReplacer("[", "", "]", "", "...", "").Replace(usage))
+}
+
+// isLiteral returns true if the given usage token alternative is a word to be typed as is rather than the name of an argument, like rollout's "status".
+func isLiteral(alternative string) bool {
+	return alternative != "" && strings.ToLower(alternative) == alternative
+}
+
+// argCandidates returns the possible values for the argument after the given ones.
+// The argument's kind is worked out from the command's usage tokens. Literal words in the arguments so far move the position to the token after the one they appear in, so commands like rollout that have their own subcommands are followed correctly.
+func argCandidates(commands map[string]subcmd.Command, tokens, args []string, repoDir string) []string {
+	// Once a literal word has been typed, the remaining arguments belong to it, so no more literals are offered.
+	pos, sawLiteral := 0, false
+	for _, arg := range args {
+		next := pos + 1
+		if pos < len(tokens) && strings.Contains(tokens[pos], "|") {
+		search:
+			for i := pos; i < len(tokens); i++ {
+				for _, alternative := range strings.Split(tokens[i], "|") {
+					if isLiteral(alternative) && alternative == arg {
+						next, sawLiteral = i+1, true
+						break search
+					}
+				}
+			}
+		}
+		pos = next
+	}
+	if pos >= len(tokens) {
+		return nil
+	}
+
+	candidates := []string{}
+	if strings.Contains(tokens[pos], "|") && !sawLiteral {
+		// Any of the literal words from here on can come next.
+		for _, token := range tokens[pos:] {
+			for _, alternative := range strings.Split(token, "|") {
+				if isLiteral(alternative) && !contains(candidates, alternative) {
+					candidates = append(candidates, alternative)
+				}
+			}
+		}
+	}
+
+	for _, alternative := range strings.Split(tokens[pos], "|") {
+		switch {
+		case isLiteral(alternative):
+		case alternative == "REPO_DIR", alternative == "FILE_STORAGE", alternative == "SOURCE", strings.HasSuffix(alternative, "_DIR"):
+			return []string{FilesDirective}
+		case alternative == "CHANNEL_ID", alternative == "SOURCE_CHANNEL", alternative == "TARGET_CHANNEL":
+			candidates = append(candidates, channelIds(repoDir)...)
+		case strings.HasSuffix(alternative, "VERSION_ID"), alternative == "FROM_ID", alternative == "TO_ID", alternative == "TARGET_ID":
+			candidates = append(candidates, versionIds(repoDir)...)
+		case alternative == "COMMAND":
+			candidates = append(candidates, commandNames(commands)...)
+		}
+	}
+	return candidates
+}
+
+// channelIds returns the IDs of the channels in the given repository, or nothing if its index can't be read.
+func channelIds(repoDir string) []string {
+	ids := []string{}
+	if indexData, err := repoutil.LoadIndex(repoDir); err == nil && repoDir != "" {
+		for _, channel := range indexData.Channels {
+			ids = append(ids, channel.Id)
+		}
+	}
+	return ids
+}
+
+// versionIds returns the IDs of the versions in the given repository, newest first, or nothing if its index can't be read.
+func versionIds(repoDir string) []string {
+	ids := []string{}
+	if indexData, err := repoutil.LoadIndex(repoDir); err == nil && repoDir != "" {
+		for i := len(indexData.Versions) - 1; i >= 0; i-- {
+			ids = append(ids, strconv.Itoa(indexData.Versions[i].Id))
+		}
+	}
+	return ids
+}
+
+// filter returns the candidates that start with the given prefix. The files directive is always kept.
+func filter(candidates []string, prefix string) []string {
+	matches := []string{}
+	for _, candidate := range candidates {
+		if candidate == FilesDirective || strings.HasPrefix(candidate, prefix) {
+			matches = append(matches, candidate)
+		}
+	}
+	return matches
+}
+
+func contains(list []string, item string) bool {
+	for _, listItem := range list {
+		if listItem == item {
+			return true
+		}
+	}
+	return false
+}
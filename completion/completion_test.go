@@ -0,0 +1,112 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package completion
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/MultiMC/repoman/subcmd"
+
+	"github.com/MultiMC/GoUpdate/repo"
+)
+
+// testCommand is a command with the given usage string and a --reason option that takes a value and a --force option that doesn't.
+type testCommand struct {
+	usage  string
+	reason string
+	force  bool
+}
+
+func (cmd *testCommand) Execute(args ...string) subcmd.Error { return nil }
+func (cmd *testCommand) Summary() string                     { return "" }
+func (cmd *testCommand) Description() string                 { return "" }
+func (cmd *testCommand) Usage() string                       { return cmd.usage }
+func (cmd *testCommand) ArgHelp() string                     { return "" }
+func (cmd *testCommand) SetFlags(flags *flag.FlagSet) {
+	flags.StringVar(&cmd.reason, "reason", "", "")
+	flags.BoolVar(&cmd.force, "force", false, "")
+}
+
+func TestComplete(t *testing.T) {
+	repoDir, err := ioutil.TempDir("", "repoman-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(repoDir)
+	index := `{"ApiVersion": 0, "Versions": [{"Id": 1, "Name": "a"}, {"Id": 2, "Name": "b"}], "Channels": [{"Id": "stable", "Name": "Stable", "CurrentVersion": 1}, {"Id": "beta", "Name": "Beta", "CurrentVersion": 2}]}`
+	if err := ioutil.WriteFile(path.Join(repoDir, repo.IndexFileName), []byte(index), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	commands := map[string]subcmd.Command{
+		"setchan":    &testCommand{usage: "REPO_DIR CHANNEL_ID VERSION_ID [REASON]"},
+		"serve":      &testCommand{usage: "REPO_DIR [FILE_STORAGE]"},
+		"rollout":    &testCommand{usage: "REPO_DIR start|advance CHANNEL_ID VERSION_ID|status [CHANNEL_ID]"},
+		"help":       &testCommand{usage: "[COMMAND]"},
+		"__complete": &testCommand{usage: "[WORD...]"},
+	}
+	files := []string{FilesDirective}
+
+	tests := []struct {
+		words []string
+		want  []string
+	}{
+		{[]string{}, []string{"help", "rollout", "serve", "setchan"}},
+		{[]string{""}, []string{"help", "rollout", "serve", "setchan"}},
+		{[]string{"se"}, []string{"serve", "setchan"}},
+		{[]string{"--output", "json", "-v", "set"}, []string{"setchan"}},
+		{[]string{"--config=repoman.json", "ro"}, []string{"rollout"}},
+		{[]string{"--output", ""}, []string{"text", "json"}},
+		{[]string{"--config", ""}, files},
+		{[]string{"bogus", ""}, nil},
+
+		{[]string{"setchan", ""}, files},
+		{[]string{"setchan", repoDir, ""}, []string{"stable", "beta"}},
+		{[]string{"setchan", repoDir, "b"}, []string{"beta"}},
+		{[]string{"setchan", repoDir, "stable", ""}, []string{"2", "1"}},
+		{[]string{"setchan", repoDir, "stable", "1", ""}, []string{}},
+		{[]string{"setchan", repoDir, "stable", "1", "why", ""}, []string{}},
+		{[]string{"setchan", "/nonexistent", ""}, []string{}},
+
+		// Options are skipped wherever they are, along with their values.
+		{[]string{"setchan", "--force", repoDir, ""}, []string{"stable", "beta"}},
+		{[]string{"setchan", repoDir, "--reason", "why", ""}, []string{"stable", "beta"}},
+		{[]string{"setchan", repoDir, "--reason=why", "stable", ""}, []string{"2", "1"}},
+		{[]string{"setchan", repoDir, "--reason", ""}, files},
+		{[]string{"setchan", repoDir, "--f"}, []string{"--force"}},
+		{[]string{"setchan", "--", repoDir, ""}, []string{"stable", "beta"}},
+
+		{[]string{"serve", repoDir, ""}, files},
+		{[]string{"help", ""}, []string{"help", "rollout", "serve", "setchan"}},
+
+		// Literal words are offered along with the argument they replace, and move the position past themselves.
+		{[]string{"rollout", repoDir, ""}, []string{"start", "advance", "status"}},
+		{[]string{"rollout", repoDir, "st"}, []string{"start", "status"}},
+		{[]string{"rollout", repoDir, "start", ""}, []string{"stable", "beta"}},
+		{[]string{"rollout", repoDir, "start", "beta", ""}, []string{"2", "1"}},
+		{[]string{"rollout", repoDir, "status", ""}, []string{"stable", "beta"}},
+	}
+
+	for _, test := range tests {
+		if got := Complete(commands, test.words); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Complete(%q) = %q, want %q", test.words, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package completion
+
+// scripts maps shell names to their completion scripts. PROG is replaced with the name RepoMan was run as.
+// Every script hands the words typed so far to the __complete command, so completions always match the installed RepoMan.
+var scripts = map[string]string{
+	"bash": bashScript,
+	"zsh":  zshScript,
+	"fish": fishScript,
+}
+
+const bashScript = `# bash completion for PROG
+_PROG_complete() {
+    local IFS=$'\n'
+    local candidates
+    candidates=($(PROG __complete -- "${COMP_WORDS[@]:1:COMP_CWORD}" 2>/dev/null))
+    if [ "${candidates[0]}" = "` + FilesDirective + `" ]; then
+        compopt -o default 2>/dev/null
+        COMPREPLY=()
+    else
+        COMPREPLY=("${candidates[@]}")
+    fi
+}
+complete -F _PROG_complete PROG
+`
+
+const zshScript = `#compdef PROG
+# zsh completion for PROG
+_PROG_complete() {
+    local -a candidates
+    candidates=(${(f)"$(PROG __complete -- "${(@)words[2,CURRENT]}" 2>/dev/null)"})
+    if [[ "${candidates[1]}" == "` + FilesDirective + `" ]]; then
+        _files
+    else
+        compadd -a candidates
+    fi
+}
+compdef _PROG_complete PROG
+`
+
+const fishScript = `# fish completion for PROG
+function __PROG_complete
+    set -l words (commandline -opc)
+    set -l current (commandline -ct)
+    set -l candidates (PROG __complete -- $words[2..-1] "$current" 2>/dev/null)
+    if test "$candidates[1]" = "` + FilesDirective + `"
+        __fish_complete_path (commandline -ct)
+    else
+        printf '%s\n' $candidates
+    end
+end
+complete -c PROG -f -a '(__PROG_complete)'
+`
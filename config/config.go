@@ -0,0 +1,185 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+config loads RepoMan's per-repository configuration, which holds defaults for arguments that would otherwise have to be repeated on every command line.
+*/
+
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MultiMC/repoman/md5util"
+	"github.com/MultiMC/repoman/subcmd"
+)
+
+// FileName is the name of the configuration file RepoMan looks for in the repository directory.
+const FileName = "repoman.json"
+
+// PathEnvVar is the name of the environment variable that can point at a configuration file to use instead of the one in the repository directory.
+const PathEnvVar = "REPOMAN_CONFIG"
+
+// Path is the configuration file to use instead of the one in the repository directory. It is set by the global --config option.
+var Path string
+
+// Transfer modes, which control how new files get into the file storage directory.
+const (
+	// TransferCopy copies new files into storage.
+	TransferCopy = "copy"
+	// TransferLink hard links new files into storage. The new version's directory must be on the same file system as storage.
+	TransferLink = "link"
+	// TransferMove moves new files into storage, removing them from the new version's directory.
+	TransferMove = "move"
+)
+
+// Config holds a repository's configuration. Blank fields aren't configured.
+type Config struct {
+	// FileStorage is the path to the file storage directory. If it is relative, it is relative to the directory of the configuration file.
+	FileStorage string `json:",omitempty"`
+
+	// URLBase is the base URL of the file storage directory, used to create HTTP sources in new versions.
+	URLBase string `json:",omitempty"`
+
+	// RepoURLBase is the base URL the repository directory itself is published at.
+	RepoURLBase string `json:",omitempty"`
+
+	// HashAlgorithms lists the hashes to record for each file in new versions. MD5 sums are always recorded since GoUpdate clients need them.
+	HashAlgorithms []string `json:",omitempty"`
+
+	// TransferMode is one of the Transfer constants. Defaults to TransferCopy.
+	TransferMode string `json:",omitempty"`
+
+	// PreHooks are shell commands run before each change to the index. Any of them can reject the change by exiting with a non-zero status.
+	PreHooks []string `json:",omitempty"`
+
+	// PostHooks are shell commands run after each change to the index.
+	PostHooks []string `json:",omitempty"`
+
+	// PurgeList is the file the public URLs affected by each change to the index are appended to. If it is relative, it is relative to the directory of the configuration file.
+	PurgeList string `json:",omitempty"`
+}
+
+// envVars maps the environment variables that override configuration values to setters for those values.
+var envVars = map[string]func(cfg *Config, value string){
+	"REPOMAN_FILE_STORAGE":    func(cfg *Config, value string) { cfg.FileStorage = value },
+	"REPOMAN_URL_BASE":        func(cfg *Config, value string) { cfg.URLBase = value },
+	"REPOMAN_REPO_URL_BASE":   func(cfg *Config, value string) { cfg.RepoURLBase = value },
+	"REPOMAN_HASH_ALGORITHMS": func(cfg *Config, value string) { cfg.HashAlgorithms = SplitList(value) },
+	"REPOMAN_TRANSFER_MODE":   func(cfg *Config, value string) { cfg.TransferMode = value },
+	"REPOMAN_PURGE_LIST":      func(cfg *Config, value string) { cfg.PurgeList = value },
+}
+
+// Load loads the configuration for the given repository.
+// The configuration file is read from Path, from the file named by the REPOMAN_CONFIG environment variable, or from the repository directory, in that order. Having no configuration file in the repository directory isn't an error.
+// Values set by REPOMAN_* environment variables override the ones in the file.
+func Load(repoDir string) (cfg Config, err subcmd.Error) {
+	cfgPath, explicit := Path, true
+	if cfgPath == "" {
+		cfgPath = os.Getenv(PathEnvVar)
+	}
+	if cfgPath == "" {
+		cfgPath, explicit = filepath.Join(repoDir, FileName), false
+	}
+
+	if data, readErr := ioutil.ReadFile(cfgPath); readErr != nil {
+		switch {
+		case os.IsNotExist(readErr) && !explicit:
+			// No configuration; everything has to come from the environment or the command line.
+		case os.IsNotExist(readErr):
+			return cfg, subcmd.CausedError(fmt.Sprintf("Configuration file %s doesn't exist.", cfgPath), 19, readErr)
+		case os.IsPermission(readErr):
+			return cfg, subcmd.CausedError(fmt.Sprintf("Can't read configuration file %s: permission denied.", cfgPath), 28, readErr)
+		default:
+			return cfg, subcmd.CausedError(fmt.Sprintf("Can't read configuration file %s: an unknown error occurred.", cfgPath), -2, readErr)
+		}
+	} else {
+		if jsonErr := json.Unmarshal(data, &cfg); jsonErr != nil {
+			return cfg, subcmd.CausedError(fmt.Sprintf("Configuration file %s is not valid JSON.", cfgPath), 19, jsonErr)
+		}
+		if cfg.FileStorage != "" && !filepath.IsAbs(cfg.FileStorage) {
+			cfg.FileStorage = filepath.Join(filepath.Dir(cfgPath), cfg.FileStorage)
+		}
+		if cfg.PurgeList != "" && cfg.PurgeList != "-" && !filepath.IsAbs(cfg.PurgeList) {
+			cfg.PurgeList = filepath.Join(filepath.Dir(cfgPath), cfg.PurgeList)
+		}
+	}
+
+	for name, set := range envVars {
+		if value := os.Getenv(name); value != "" {
+			set(&cfg, value)
+		}
+	}
+
+	if cfg.TransferMode == "" {
+		cfg.TransferMode = TransferCopy
+	}
+	return cfg, cfg.Validate()
+}
+
+// Validate makes sure the configuration's transfer mode and hash algorithms are ones RepoMan knows about.
+func (cfg Config) Validate() subcmd.Error {
+	switch cfg.TransferMode {
+	case TransferCopy, TransferLink, TransferMove:
+	default:
+		return subcmd.MessageError(fmt.Sprintf("Invalid configuration: unknown transfer mode '%s'. Must be %s, %s, or %s.", cfg.TransferMode, TransferCopy, TransferLink, TransferMove), 19)
+	}
+	for _, algorithm := range cfg.HashAlgorithms {
+		if !md5util.SupportedHash(algorithm) {
+			return subcmd.MessageError(fmt.Sprintf("Invalid configuration: unknown hash algorithm '%s'. Must be one of %s.", algorithm, strings.Join(md5util.HashNames(), ", ")), 19)
+		}
+	}
+	return nil
+}
+
+// Pick returns the given command line argument, or the configured value if the argument is blank or "-".
+func Pick(arg, configured string) string {
+	if arg == "" || arg == "-" {
+		return configured
+	}
+	return arg
+}
+
+// StorageDir returns the file storage directory given on the command line, or the configured one for the given repository if the argument is blank or "-".
+func StorageDir(repoDir, arg string) (string, subcmd.Error) {
+	if arg != "" && arg != "-" {
+		return arg, nil
+	}
+	cfg, err := Load(repoDir)
+	return cfg.FileStorage, err
+}
+
+// Require returns a usage error if the given value is blank, saying that it needs to be given on the command line or configured.
+func Require(value, what string) subcmd.Error {
+	if value == "" {
+		return subcmd.UsageError(fmt.Sprintf("No %s was given, and none is configured.", what))
+	}
+	return nil
+}
+
+// SplitList splits a comma separated list, ignoring blank entries and surrounding spaces.
+func SplitList(list string) []string {
+	items := []string{}
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
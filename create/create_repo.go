@@ -19,17 +19,21 @@ create contains the Command struct for repoman's "create" subcommand.
 package create
 
 import (
-	"encoding/json"
+	"flag"
 	"fmt"
-	"io/ioutil"
 	"os"
-	"path"
+	"path/filepath"
 
+	"github.com/MultiMC/repoman/logging"
+	"github.com/MultiMC/repoman/publish"
+	"github.com/MultiMC/repoman/repoutil"
 	"github.com/MultiMC/repoman/subcmd"
 
 	"github.com/MultiMC/GoUpdate/repo"
 )
 
+var log = logging.New("create")
+
 type Command struct{}
 
 func (cmd Command) Summary() string { return "Creates a new GoUpdate repository." }
@@ -40,6 +44,10 @@ func (cmd Command) Usage() string { return "REPO_DIR" }
 func (cmd Command) ArgHelp() string {
 	return "REPO_DIR - The repository's directory. This directory must not already exist. It will be created."
 }
+func (cmd Command) SetFlags(flags *flag.FlagSet) {
+	repoutil.AddDryRunFlag(flags)
+	publish.AddPurgeListFlag(flags)
+}
 
 func (cmd Command) Execute(args ...string) subcmd.Error {
 	// Determine what directory to create the repository in.
@@ -47,14 +55,24 @@ func (cmd Command) Execute(args ...string) subcmd.Error {
 		return subcmd.UsageError("'create' command requires at least one argument.")
 	} else {
 		repoDir := args[0]
-		return CreateRepo(repoDir)
+		return repoutil.FinishChange(repoDir, CreateRepo(repoDir))
 	}
 }
 
+// CreateRepo creates a new repository with a blank index in the given directory, which must not exist yet. The creation is recorded in the audit log as made by the command being run.
 func CreateRepo(repoDir string) subcmd.Error {
-	fileMode := os.FileMode(0644)
+	return CreateRepoAs(repoDir, repoutil.CurrentInvocation)
+}
+
+// CreateRepoAs is CreateRepo for repositories created by the given invocation rather than the command being run, such as the daemon's requests.
+// The blank index is written with the repository locked and goes through the pre- and post-hooks like any other change to the index. If a pre-hook rejects it, the new directory is removed again.
+func CreateRepoAs(repoDir string, invocation repoutil.Invocation) subcmd.Error {
 	dirMode  := os.FileMode(0755)
 
+	if repoutil.DryRun {
+		return dryRunCreate(repoDir)
+	}
+
 	// Try to create the repository directory. If it already exists, this should cause an error. We shouldn't try to create a repository in a directory that already exists.
 	if err := os.Mkdir(repoDir, dirMode); err != nil {
 		if os.IsExist(err) {
@@ -69,25 +87,34 @@ func CreateRepo(repoDir string) subcmd.Error {
 		}
 	}
 
-	// Determine the path to the index file.
-	indexFilePath := path.Join(repoDir, repo.IndexFileName)
-
-	// Get a new, blank index data struct.
-	indexData := repo.NewBlankIndex()
-
-	// Serialize the index structure to JSON...
-	jsonData, jsonError := json.Marshal(indexData)
-
-	if jsonError != nil {
-		return subcmd.CausedError("Failed to marshal index data to JSON. This probably shouldn't happen...", -1, jsonError)
+	// Now that the directory exists, the blank index can be written like any other change.
+	indexData := repoutil.Index{Index: repo.NewBlankIndex()}
+	err := repoutil.WithLockAs(repoDir, invocation, func() subcmd.Error {
+		if err := publish.WriteIndex(repoDir, indexData); err != nil {
+			return err
+		}
+		return publish.Refresh(repoDir, "")
+	})
+	if err != nil {
+		// If the index was never written, nothing else was either, so the directory is empty and can go.
+		if _, statErr := os.Stat(filepath.Join(repoDir, repo.IndexFileName)); os.IsNotExist(statErr) {
+			os.Remove(repoDir)
+		}
+		return err
 	}
 
-	// ...and write it to the index file.
-	writeError := ioutil.WriteFile(indexFilePath, jsonData, fileMode)
+	log.Info("Created repository", "repo", repoDir, "index", filepath.Join(repoDir, repo.IndexFileName))
+	return nil
+}
 
-	if writeError != nil {
-		return subcmd.CausedError("Failed to write index file.", 20, writeError)
+// dryRunCreate makes the same checks CreateRepo's first step would and describes the repository it would create.
+func dryRunCreate(repoDir string) subcmd.Error {
+	if _, err := os.Stat(repoDir); err == nil {
+		return subcmd.CategoryError(subcmd.Conflict, fmt.Sprintf("Can't create repository at %s because the directory already exists. Cannot create a repository in an existing directory.", repoDir), 11, nil)
 	}
-
+	if _, err := os.Stat(filepath.Dir(repoDir)); err != nil {
+		return subcmd.CausedError(fmt.Sprintf("Can't create repository at %s. Make sure the parent directory exists.", repoDir), 12, err)
+	}
+	repoutil.DryRunf("create the repository directory %s with a blank index.", repoDir)
 	return nil
 }
@@ -0,0 +1,179 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package daemon
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// extractArchive extracts the given .zip or .tar.gz archive into destDir, keeping the permissions of the files in it.
+// It fails if the archive has more files or bigger files than the given limits allow.
+func extractArchive(archivePath, archiveName, destDir string, limits Limits) error {
+	budget := &extractBudget{limits: limits}
+	switch {
+	case strings.HasSuffix(archiveName, ".zip"):
+		return extractZip(archivePath, destDir, budget)
+	case strings.HasSuffix(archiveName, ".tar.gz"), strings.HasSuffix(archiveName, ".tgz"):
+		return extractTarGz(archivePath, destDir, budget)
+	default:
+		return fmt.Errorf("unsupported archive type for %s; must be .zip, .tar.gz, or .tgz", archiveName)
+	}
+}
+
+// extractBudget keeps track of how much of an archive has been extracted, so extraction can stop once it goes over the limits.
+// Sizes are counted as the files are written rather than taken from the archive's headers, which can lie.
+type extractBudget struct {
+	limits Limits
+	files  int
+	bytes  int64
+}
+
+// addFile counts another file, failing if there are too many.
+func (b *extractBudget) addFile() error {
+	b.files++
+	if b.limits.MaxFiles > 0 && b.files > b.limits.MaxFiles {
+		return fmt.Errorf("archive has more than %d files", b.limits.MaxFiles)
+	}
+	return nil
+}
+
+// copy copies contents to w, failing if that takes the extracted files over the size limit.
+func (b *extractBudget) copy(w io.Writer, contents io.Reader) error {
+	if b.limits.MaxExtracted <= 0 {
+		_, err := io.Copy(w, contents)
+		return err
+	}
+	written, err := io.Copy(w, io.LimitReader(contents, b.limits.MaxExtracted-b.bytes+1))
+	b.bytes += written
+	if err == nil && b.bytes > b.limits.MaxExtracted {
+		err = fmt.Errorf("archive's files add up to more than %d bytes", b.limits.MaxExtracted)
+	}
+	return err
+}
+
+// destPath returns where the archive entry with the given name should be extracted to, making sure it doesn't escape destDir.
+func destPath(destDir, name string) (string, error) {
+	target := filepath.Join(destDir, filepath.FromSlash(name))
+	if target != destDir && !strings.HasPrefix(target, destDir+string(filepath.Separator)) {
+		return "", fmt.Errorf("archive entry %s is outside the archive", name)
+	}
+	return target, nil
+}
+
+func writeEntry(target string, mode os.FileMode, contents io.Reader, budget *extractBudget) error {
+	if err := budget.addFile(); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode.Perm())
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// The permissions passed to OpenFile are masked by the umask, but GoUpdate versions record exact permissions.
+	if err := file.Chmod(mode.Perm()); err != nil {
+		return err
+	}
+
+	return budget.copy(file, contents)
+}
+
+func extractZip(archivePath, destDir string, budget *extractBudget) error {
+	reader, err := zip.OpenReader(archivePath)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	for _, entry := range reader.File {
+		target, err := destPath(destDir, entry.Name)
+		if err != nil {
+			return err
+		}
+
+		if entry.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		if !entry.Mode().IsRegular() {
+			continue
+		}
+
+		contents, err := entry.Open()
+		if err != nil {
+			return err
+		}
+		err = writeEntry(target, entry.Mode(), contents, budget)
+		contents.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func extractTarGz(archivePath, destDir string, budget *extractBudget) error {
+	file, err := os.Open(archivePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+
+	reader := tar.NewReader(gz)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		target, err := destPath(destDir, header.Name)
+		if err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := writeEntry(target, os.FileMode(header.Mode), reader, budget); err != nil {
+				return err
+			}
+		}
+		// Links and other special files can't be part of a GoUpdate version, so they are skipped.
+	}
+}
@@ -0,0 +1,124 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package daemon
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// archiveFile is a file to put in a test archive.
+type archiveFile struct {
+	name     string
+	contents string
+}
+
+func writeZip(t *testing.T, path string, files []archiveFile) {
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	writer := zip.NewWriter(out)
+	for _, file := range files {
+		entry, err := writer.Create(file.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entry.Write([]byte(file.contents))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func writeTarGz(t *testing.T, path string, files []archiveFile) {
+	out, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	gz := gzip.NewWriter(out)
+	writer := tar.NewWriter(gz)
+	for _, file := range files {
+		writer.WriteHeader(&tar.Header{Name: file.name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(file.contents))})
+		writer.Write([]byte(file.contents))
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	gz.Close()
+}
+
+func TestExtractArchive(t *testing.T) {
+	files := []archiveFile{{"a.txt", "aaaa"}, {"lib/b.txt", "bbbb"}, {"lib/c.txt", "cccc"}}
+	tests := []struct {
+		desc   string
+		files  []archiveFile
+		limits Limits
+		err    string
+	}{
+		{"within limits", files, Limits{MaxFiles: 3, MaxExtracted: 12}, ""},
+		{"no limits", files, Limits{}, ""},
+		{"too many files", files, Limits{MaxFiles: 2}, "more than 2 files"},
+		{"too many bytes", files, Limits{MaxExtracted: 11}, "more than 11 bytes"},
+		{"parent directory", []archiveFile{{"../escaped.txt", "x"}}, Limits{}, "outside the archive"},
+		{"nested parent directory", []archiveFile{{"lib/../../escaped.txt", "x"}}, Limits{}, "outside the archive"},
+	}
+
+	for _, format := range []string{"files.zip", "files.tar.gz"} {
+		for _, test := range tests {
+			t.Run(format+"/"+test.desc, func(t *testing.T) {
+				dir := t.TempDir()
+				archivePath := filepath.Join(dir, format)
+				if format == "files.zip" {
+					writeZip(t, archivePath, test.files)
+				} else {
+					writeTarGz(t, archivePath, test.files)
+				}
+
+				destDir := filepath.Join(dir, "out")
+				err := extractArchive(archivePath, format, destDir, test.limits)
+				if test.err == "" {
+					if err != nil {
+						t.Fatal(err)
+					}
+					contents, err := ioutil.ReadFile(filepath.Join(destDir, "lib", "c.txt"))
+					if err != nil || string(contents) != "cccc" {
+						t.Errorf("lib/c.txt contains %q (%v), want \"cccc\"", contents, err)
+					}
+				} else if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("got error %v, want one containing %q", err, test.err)
+				}
+
+				if _, err := os.Stat(filepath.Join(dir, "escaped.txt")); err == nil {
+					t.Error("an archive entry was written outside the destination")
+				}
+			})
+		}
+	}
+}
+
+func TestUnsupportedArchive(t *testing.T) {
+	if err := extractArchive("/nonexistent", "files.rar", t.TempDir(), Limits{}); err == nil {
+		t.Error("extracting a .rar archive succeeded")
+	}
+}
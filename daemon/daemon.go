@@ -0,0 +1,396 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+daemon contains the Command struct for repoman's "daemon" subcommand, which exposes repository management operations as a JSON HTTP API.
+*/
+
+package daemon
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/MultiMC/repoman/config"
+	"github.com/MultiMC/repoman/create"
+	"github.com/MultiMC/repoman/logging"
+	"github.com/MultiMC/repoman/publish"
+	"github.com/MultiMC/repoman/repoutil"
+	"github.com/MultiMC/repoman/setchan"
+	"github.com/MultiMC/repoman/subcmd"
+	"github.com/MultiMC/repoman/update"
+)
+
+var log = logging.New("daemon")
+
+// TokenEnvVar is the name of the environment variable that holds the token API clients must send.
+const TokenEnvVar = "REPOMAN_TOKEN"
+
+// maxFieldSize is the largest value the daemon accepts for a form field of an upload other than the archive.
+const maxFieldSize = 64 * 1024
+
+type Command struct {
+	addr   string
+	limits Limits
+}
+
+func (cmd Command) Summary() string {
+	return "Runs an HTTP server that exposes repository operations as a JSON API."
+}
+func (cmd Command) Description() string {
+	return "Runs an HTTP server that lets remote tools create the repository, upload new versions, set channels, and read the index. Every request must send the token from the " + TokenEnvVar + " environment variable as a bearer token. Changes to the repository are made one at a time while holding the repository's lock. Uploads are processed in the background as jobs whose progress can be polled."
+}
+func (cmd Command) Usage() string { return "REPO_DIR [FILE_STORAGE] [URL_BASE]" }
+func (cmd Command) ArgHelp() string {
+	return "REPO_DIR - The repository directory to manage.\nFILE_STORAGE - The repository's file storage directory. Defaults to the configured one.\nURL_BASE - The base URL to use to create HTTP sources in new versions, as for the update command. Defaults to the configured one."
+}
+
+func (cmd *Command) SetFlags(flags *flag.FlagSet) {
+	flags.StringVar(&cmd.addr, "address", ":8081", "The `ADDRESS` to listen on.")
+	flags.Int64Var(&cmd.limits.MaxUpload, "max-upload", 1<<30, "Refuse update uploads larger than `BYTES`.")
+	flags.Int64Var(&cmd.limits.MaxExtracted, "max-extracted", 4<<30, "Refuse update archives whose files add up to more than `BYTES`.")
+	flags.IntVar(&cmd.limits.MaxFiles, "max-files", 100000, "Refuse update archives with more than `COUNT` files.")
+}
+
+func (cmd Command) Execute(args ...string) subcmd.Error {
+	if len(args) < 1 {
+		return subcmd.UsageError("'daemon' command requires at least one argument.")
+	} else {
+		// Pad the optional arguments so they can be picked from the configuration when they're missing.
+		args = append(args, "", "")
+		addr := cmd.addr
+
+		cfg, cfgErr := config.Load(args[0])
+		if cfgErr != nil {
+			return cfgErr
+		}
+		cfg.FileStorage = config.Pick(args[1], cfg.FileStorage)
+		cfg.URLBase = config.Pick(args[2], cfg.URLBase)
+		if err := config.Require(cfg.FileStorage, "file storage directory"); err != nil {
+			return err
+		}
+		if err := config.Require(cfg.URLBase, "URL base"); err != nil {
+			return err
+		}
+
+		token := os.Getenv(TokenEnvVar)
+		if token == "" {
+			return subcmd.MessageError(fmt.Sprintf("Refusing to start without an API token. Set the %s environment variable.", TokenEnvVar), 71)
+		}
+
+		d := &Daemon{RepoDir: args[0], Config: cfg, Token: token, Limits: cmd.limits, jobs: newJobList()}
+		log.Notice("Managing repository", "repo", d.RepoDir, "address", addr)
+		if err := http.ListenAndServe(addr, d); err != nil {
+			return subcmd.CausedError(fmt.Sprintf("HTTP server on %s failed.", addr), 70, err)
+		}
+		return nil
+	}
+}
+
+// Daemon is the HTTP handler for the management API.
+type Daemon struct {
+	RepoDir string
+	Token   string
+
+	// Config holds the file storage directory, URL base, and other settings used for new versions.
+	Config config.Config
+
+	Limits Limits
+
+	// mutate is held while changing the repository, so requests to this daemon queue up instead of failing on the repository lock.
+	mutate sync.Mutex
+
+	jobs *jobList
+}
+
+// Limits bounds what clients can make the daemon store. Zero fields mean no limit.
+type Limits struct {
+	// MaxUpload is the largest request body an update upload can have, in bytes.
+	MaxUpload int64
+
+	// MaxExtracted is the largest total size of the files in an update archive, in bytes, and MaxFiles is the most files it can have.
+	MaxExtracted int64
+	MaxFiles     int
+}
+
+// apiError is the body of every error response.
+type apiError struct {
+	Error    string
+	ExitCode int `json:",omitempty"`
+}
+
+func (d *Daemon) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	auth := r.Header.Get("Authorization")
+	if subtle.ConstantTimeCompare([]byte(auth), []byte("Bearer "+d.Token)) != 1 {
+		writeJSON(w, http.StatusUnauthorized, apiError{Error: "Missing or invalid API token."})
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/api/list" && r.Method == "GET":
+		d.handleList(w, r)
+	case r.URL.Path == "/api/create" && r.Method == "POST":
+		d.handleCreate(w, r)
+	case r.URL.Path == "/api/setchan" && r.Method == "POST":
+		d.handleSetChan(w, r)
+	case r.URL.Path == "/api/update" && r.Method == "POST":
+		d.handleUpdate(w, r)
+	case r.URL.Path == "/api/jobs" && r.Method == "GET":
+		writeJSON(w, http.StatusOK, d.jobs.all())
+	case strings.HasPrefix(r.URL.Path, "/api/jobs/") && r.Method == "GET":
+		id, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/api/jobs/"))
+		if job, ok := d.jobs.get(id); err == nil && ok {
+			writeJSON(w, http.StatusOK, job)
+		} else {
+			writeJSON(w, http.StatusNotFound, apiError{Error: "No such job."})
+		}
+	default:
+		writeJSON(w, http.StatusNotFound, apiError{Error: "No such API endpoint."})
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	jsonData, _ := json.MarshalIndent(data, "", "  ")
+	w.Write(jsonData)
+}
+
+// writeError sends the given command error with an HTTP status that matches what went wrong.
+func writeError(w http.ResponseWriter, err subcmd.Error) {
+	status := http.StatusInternalServerError
+	switch {
+	case err.ShowUsage(), err.ExitCode() == repoutil.InvalidIndexExitCode:
+		status = http.StatusBadRequest
+	case err.ExitCode() == repoutil.LockedExitCode, err.ExitCode() == publish.HookVetoExitCode, err.ExitCode() == 11, err.ExitCode() == 44, err.ExitCode() == 46:
+		status = http.StatusConflict
+	}
+	writeJSON(w, status, apiError{Error: err.Error(), ExitCode: err.ExitCode()})
+}
+
+// locked runs fn while holding both the daemon's mutation lock and the repository's lock. The change is recorded in the audit log as made by the given invocation.
+func (d *Daemon) locked(invocation repoutil.Invocation, fn func() subcmd.Error) subcmd.Error {
+	d.mutate.Lock()
+	defer d.mutate.Unlock()
+	return repoutil.WithLockAs(d.RepoDir, invocation, fn)
+}
+
+// invocation describes a request as the equivalent command for the audit log, with the request's fields as its arguments.
+func (d *Daemon) invocation(r *http.Request, command string, args ...string) repoutil.Invocation {
+	return repoutil.Invocation{Command: command, Args: append([]string{d.RepoDir}, args...), Client: r.RemoteAddr}
+}
+
+func (d *Daemon) handleList(w http.ResponseWriter, r *http.Request) {
+	indexData, err := repoutil.LoadIndex(d.RepoDir)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, indexData)
+}
+
+func (d *Daemon) handleCreate(w http.ResponseWriter, r *http.Request) {
+	// CreateRepoAs locks the repository once its directory exists, so only the daemon's own lock is held here.
+	d.mutate.Lock()
+	err := create.CreateRepoAs(d.RepoDir, d.invocation(r, "create"))
+	d.mutate.Unlock()
+
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, struct{}{})
+}
+
+// setChanRequest is the body of a setchan request.
+type setChanRequest struct {
+	Channel string
+	Version int
+	Reason  string
+}
+
+func (d *Daemon) handleSetChan(w http.ResponseWriter, r *http.Request) {
+	var req setChanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Channel == "" || req.Version < 0 {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: "Request body must be a JSON object with a Channel and a positive Version."})
+		return
+	}
+
+	args := []string{req.Channel, strconv.Itoa(req.Version)}
+	if req.Reason != "" {
+		args = append(args, req.Reason)
+	}
+	err := d.locked(d.invocation(r, "setchan", args...), func() subcmd.Error {
+		return setchan.SetChan(d.RepoDir, req.Channel, req.Version, req.Reason)
+	})
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, struct{}{})
+}
+
+// handleUpdate accepts a multipart form containing an "archive" file (.zip or .tar.gz) with the new version's files and a "name" field with its version name.
+// The optional "id" field sets the version ID, and the "notes", "time", "commit", and "build.KEY" fields set its metadata, as for the update command.
+// The upload is saved and then processed in the background. The response holds the ID of the job processing it.
+func (d *Daemon) handleUpdate(w http.ResponseWriter, r *http.Request) {
+	if d.Limits.MaxUpload > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, d.Limits.MaxUpload)
+	}
+	reader, err := r.MultipartReader()
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, apiError{Error: "Request body must be a multipart form."})
+		return
+	}
+
+	workDir, err := ioutil.TempDir("", "repoman-upload-")
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, apiError{Error: "Couldn't create a temporary directory for the upload."})
+		return
+	}
+
+	archiveName := ""
+	fields := map[string]string{}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			os.RemoveAll(workDir)
+			writeUploadError(w, http.StatusBadRequest, "Couldn't read the upload: ", err)
+			return
+		}
+
+		if part.FormName() == "archive" {
+			archiveName = part.FileName()
+			archiveFile, err := os.Create(filepath.Join(workDir, "archive"))
+			if err == nil {
+				_, err = io.Copy(archiveFile, part)
+				archiveFile.Close()
+			}
+			if err != nil {
+				os.RemoveAll(workDir)
+				writeUploadError(w, http.StatusInternalServerError, "Couldn't save the uploaded archive: ", err)
+				return
+			}
+		} else {
+			value, err := ioutil.ReadAll(io.LimitReader(part, maxFieldSize+1))
+			if err != nil {
+				os.RemoveAll(workDir)
+				writeUploadError(w, http.StatusBadRequest, "Couldn't read the upload: ", err)
+				return
+			}
+			if len(value) > maxFieldSize {
+				os.RemoveAll(workDir)
+				writeJSON(w, http.StatusRequestEntityTooLarge, apiError{Error: fmt.Sprintf("The \"%s\" field is longer than %d bytes.", part.FormName(), maxFieldSize)})
+				return
+			}
+			fields[part.FormName()] = string(value)
+		}
+	}
+
+	if archiveName == "" || fields["name"] == "" {
+		os.RemoveAll(workDir)
+		writeJSON(w, http.StatusBadRequest, apiError{Error: "An update needs an \"archive\" file and a \"name\" field."})
+		return
+	}
+
+	versionId := update.AutoVersionId
+	if idStr := fields["id"]; idStr != "" && idStr != "auto" {
+		id, err := strconv.Atoi(idStr)
+		if err != nil || id < 0 {
+			os.RemoveAll(workDir)
+			writeJSON(w, http.StatusBadRequest, apiError{Error: "Version ID must be a positive integer or \"auto\"."})
+			return
+		}
+		versionId = id
+	}
+
+	// Only metadata that comes from the request itself is allowed. In particular, notes-file would let clients read files on the server.
+	options := []string{}
+	for key, value := range fields {
+		if key == "notes" || key == "time" || key == "commit" || strings.HasPrefix(key, "build.") {
+			options = append(options, key+"="+value)
+		}
+	}
+	sort.Strings(options)
+	meta, metaErr := update.ParseMetaOptions(options)
+	if metaErr != nil {
+		os.RemoveAll(workDir)
+		writeError(w, metaErr)
+		return
+	}
+
+	jobId := d.jobs.add("update")
+	idArg := "auto"
+	if versionId != update.AutoVersionId {
+		idArg = strconv.Itoa(versionId)
+	}
+	invocation := d.invocation(r, "update", append([]string{archiveName, fields["name"], idArg}, options...)...)
+	go d.runUpdate(jobId, invocation, workDir, archiveName, fields["name"], versionId, meta)
+
+	writeJSON(w, http.StatusAccepted, struct{ Job int }{jobId})
+}
+
+// writeUploadError responds to a request whose upload couldn't be read or saved with the given status and message, unless the upload was too large.
+func writeUploadError(w http.ResponseWriter, status int, message string, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeJSON(w, http.StatusRequestEntityTooLarge, apiError{Error: fmt.Sprintf("The upload is larger than %d bytes.", tooLarge.Limit)})
+		return
+	}
+	writeJSON(w, status, apiError{Error: message + err.Error()})
+}
+
+// runUpdate extracts an uploaded archive and adds its contents to the repository as a new version.
+func (d *Daemon) runUpdate(jobId int, invocation repoutil.Invocation, workDir, archiveName, versionName string, versionId int, meta repoutil.VersionMeta) {
+	defer os.RemoveAll(workDir)
+
+	d.jobs.progress(jobId, "Extracting archive.")
+	filesDir := filepath.Join(workDir, "files")
+	if err := extractArchive(filepath.Join(workDir, "archive"), archiveName, filesDir, d.Limits); err != nil {
+		log.Warn("Couldn't extract uploaded archive", "job", jobId, "archive", archiveName, "error", err)
+		d.jobs.finish(jobId, nil, subcmd.CausedError("Couldn't extract the uploaded archive.", 72, err))
+		return
+	}
+
+	d.jobs.progress(jobId, "Waiting for other changes to the repository to finish.")
+	var result update.Result
+	err := d.locked(invocation, func() subcmd.Error {
+		d.jobs.progress(jobId, "Updating repository.")
+		var err subcmd.Error
+		result, err = update.UpdateRepo(d.RepoDir, d.Config, filesDir, versionName, versionId, meta)
+		return err
+	})
+
+	if err != nil {
+		log.Warn("Update job failed", "job", jobId, "repo", d.RepoDir, "version", versionName, "error", err, "exitCode", err.ExitCode())
+		d.jobs.finish(jobId, nil, err)
+		return
+	}
+	d.jobs.finish(jobId, result, nil)
+	log.Info("Update job done", "job", jobId, "repo", d.RepoDir, "id", result.VersionId, "name", versionName)
+}
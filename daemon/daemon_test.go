@@ -0,0 +1,93 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package daemon
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/MultiMC/repoman/repoutil/repotest"
+)
+
+func testDaemon(t *testing.T, limits Limits) *Daemon {
+	indexData := repotest.Index([]int{1}, map[string]int{"stable": 1})
+	return &Daemon{RepoDir: repotest.Repo(t, &indexData, 1), Token: "secret", Limits: limits, jobs: newJobList()}
+}
+
+func serve(d *Daemon, r *http.Request) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	d.ServeHTTP(recorder, r)
+	return recorder
+}
+
+func TestTokenAuth(t *testing.T) {
+	d := testDaemon(t, Limits{})
+	tests := []struct {
+		auth   string
+		status int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"secret", http.StatusUnauthorized},
+		{"Bearer secret", http.StatusOK},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/api/list", nil)
+		if test.auth != "" {
+			r.Header.Set("Authorization", test.auth)
+		}
+		if got := serve(d, r).Code; got != test.status {
+			t.Errorf("Authorization %q got status %d, want %d", test.auth, got, test.status)
+		}
+	}
+}
+
+// uploadRequest builds an update request with an archive of the given size and the given form fields.
+func uploadRequest(archiveSize int, fields map[string]string) *http.Request {
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	for name, value := range fields {
+		form.WriteField(name, value)
+	}
+	archive, _ := form.CreateFormFile("archive", "files.zip")
+	archive.Write(make([]byte, archiveSize))
+	form.Close()
+
+	r := httptest.NewRequest("POST", "/api/update", body)
+	r.Header.Set("Content-Type", form.FormDataContentType())
+	r.Header.Set("Authorization", "Bearer secret")
+	return r
+}
+
+func TestUploadLimits(t *testing.T) {
+	d := testDaemon(t, Limits{MaxUpload: 4096})
+
+	if resp := serve(d, uploadRequest(8192, map[string]string{"name": "v2"})); resp.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized upload got status %d, want 413: %s", resp.Code, resp.Body)
+	}
+
+	d.Limits.MaxUpload = 0
+	if resp := serve(d, uploadRequest(16, map[string]string{"name": strings.Repeat("v", maxFieldSize+1)})); resp.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized field got status %d, want 413: %s", resp.Code, resp.Body)
+	}
+
+	if jobs := d.jobs.all(); len(jobs) != 0 {
+		t.Errorf("rejected uploads started jobs: %v", jobs)
+	}
+}
@@ -0,0 +1,164 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package daemon
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/MultiMC/repoman/subcmd"
+)
+
+// Job states.
+const (
+	JobQueued  = "queued"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+// Job is an operation the daemon is running in the background. Its exported fields are what the API reports.
+type Job struct {
+	Id    int
+	Kind  string
+	State string
+
+	// Progress is a short description of what the job is currently doing.
+	Progress string
+
+	Created time.Time
+
+	// Finished is nil until the job is done or has failed.
+	Finished *time.Time `json:",omitempty"`
+
+	// Error and ExitCode describe why a failed job failed. ExitCode is the code the equivalent command would have exited with.
+	Error    string `json:",omitempty"`
+	ExitCode int    `json:",omitempty"`
+
+	// Result holds the job's output when it is done, such as the ID of the version an update created.
+	Result interface{} `json:",omitempty"`
+}
+
+// Finished jobs are forgotten once they are older than FinishedJobAge, or once more than FinishedJobLimit newer jobs have finished, so a long-running daemon doesn't keep every job it has ever run.
+const (
+	FinishedJobAge   = 24 * time.Hour
+	FinishedJobLimit = 1000
+)
+
+// jobList keeps track of the daemon's jobs. All access to jobs goes through it so the API never sees a job half-updated.
+type jobList struct {
+	lock   sync.Mutex
+	jobs   map[int]*Job
+	nextId int
+
+	// maxAge and maxFinished are FinishedJobAge and FinishedJobLimit, except in tests.
+	maxAge      time.Duration
+	maxFinished int
+}
+
+func newJobList() *jobList {
+	return &jobList{jobs: map[int]*Job{}, nextId: 1, maxAge: FinishedJobAge, maxFinished: FinishedJobLimit}
+}
+
+// add creates a new queued job of the given kind and returns its ID.
+func (l *jobList) add(kind string) int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.prune(time.Now().UTC())
+	id := l.nextId
+	l.nextId++
+	l.jobs[id] = &Job{Id: id, Kind: kind, State: JobQueued, Progress: "Waiting to start.", Created: time.Now().UTC()}
+	return id
+}
+
+// get returns a copy of the job with the given ID.
+func (l *jobList) get(id int) (Job, bool) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	job, ok := l.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *job, true
+}
+
+// all returns copies of every job, in the order they were created.
+func (l *jobList) all() []Job {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.prune(time.Now().UTC())
+	jobs := []Job{}
+	for _, job := range l.jobs {
+		jobs = append(jobs, *job)
+	}
+	sort.Slice(jobs, func(i, j int) bool { return jobs[i].Id < jobs[j].Id })
+	return jobs
+}
+
+// progress marks the given job as running and sets its progress message.
+func (l *jobList) progress(id int, message string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.jobs[id].State = JobRunning
+	l.jobs[id].Progress = message
+}
+
+// finish marks the given job as done with the given result, or as failed if err isn't nil.
+func (l *jobList) finish(id int, result interface{}, err subcmd.Error) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	job := l.jobs[id]
+	finished := time.Now().UTC()
+	job.Finished = &finished
+	if err != nil {
+		job.State = JobFailed
+		job.Progress = "Failed."
+		job.Error = err.Error()
+		job.ExitCode = err.ExitCode()
+	} else {
+		job.State = JobDone
+		job.Progress = "Done."
+		job.Result = result
+	}
+	l.prune(finished)
+}
+
+// prune forgets finished jobs that are too old or too many, oldest first. Jobs that are still queued or running are always kept.
+// The caller must hold the lock.
+func (l *jobList) prune(now time.Time) {
+	finished := []*Job{}
+	for id, job := range l.jobs {
+		switch {
+		case job.Finished == nil:
+		case now.Sub(*job.Finished) > l.maxAge:
+			delete(l.jobs, id)
+		default:
+			finished = append(finished, job)
+		}
+	}
+
+	if len(finished) > l.maxFinished {
+		sort.Slice(finished, func(i, j int) bool { return finished[i].Finished.Before(*finished[j].Finished) })
+		for _, job := range finished[:len(finished)-l.maxFinished] {
+			delete(l.jobs, job.Id)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package daemon
+
+import (
+	"testing"
+	"time"
+)
+
+func jobIds(jobs []Job) []int {
+	ids := []int{}
+	for _, job := range jobs {
+		ids = append(ids, job.Id)
+	}
+	return ids
+}
+
+// Only the newest finished jobs are kept once there are more than the limit, and unfinished jobs are never forgotten.
+func TestFinishedJobLimit(t *testing.T) {
+	jobs := newJobList()
+	jobs.maxFinished = 2
+
+	running := jobs.add("update")
+	for i := 0; i < 4; i++ {
+		jobs.finish(jobs.add("update"), nil, nil)
+	}
+
+	if got := jobIds(jobs.all()); len(got) != 3 || got[0] != running || got[1] != 4 || got[2] != 5 {
+		t.Errorf("kept jobs %v, want [%d 4 5]", got, running)
+	}
+	if _, ok := jobs.get(2); ok {
+		t.Error("job 2 is still listed after newer jobs pushed it out")
+	}
+}
+
+func TestFinishedJobAge(t *testing.T) {
+	jobs := newJobList()
+	old := jobs.add("update")
+	jobs.finish(old, nil, nil)
+	recent := jobs.add("update")
+	jobs.finish(recent, nil, nil)
+
+	longAgo := time.Now().UTC().Add(-FinishedJobAge - time.Minute)
+	jobs.jobs[old].Finished = &longAgo
+
+	if got := jobIds(jobs.all()); len(got) != 1 || got[0] != recent {
+		t.Errorf("kept jobs %v, want [%d]", got, recent)
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+diff contains the Command struct for repoman's "diff" subcommand and functions for comparing two versions' file lists.
+*/
+
+package diff
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/MultiMC/repoman/config"
+	"github.com/MultiMC/repoman/repoutil"
+	"github.com/MultiMC/repoman/subcmd"
+
+	"github.com/MultiMC/GoUpdate/repo"
+)
+
+type Command struct{}
+
+func (cmd Command) Summary() string {
+	return "Shows the differences between two versions in a repository."
+}
+func (cmd Command) Description() string {
+	return "Compares the file lists of two versions in a repository and reports which files were added, removed, modified, or had their permissions changed, along with how much a client would need to download to go from the first version to the second."
+}
+func (cmd Command) Usage() string { return "REPO_DIR FILE_STORAGE FROM_ID TO_ID" }
+func (cmd Command) ArgHelp() string {
+	return "REPO_DIR - The repository directory containing the versions.\nFILE_STORAGE - The repository's file storage directory. This is used to determine file sizes. Give \"-\" to use the configured one.\nFROM_ID - The ID of the version to compare from.\nTO_ID - The ID of the version to compare to."
+}
+
+func (cmd Command) Execute(args ...string) subcmd.Error {
+	if len(args) != 4 {
+		// The output format used to be an optional fifth argument, so it gets a hint.
+		return subcmd.UsageError("'diff' command requires four arguments. Use the global --output option to choose the output format.")
+	} else {
+		repoDir := args[0]
+		filesDir, cfgErr := config.StorageDir(repoDir, args[1])
+		if cfgErr != nil {
+			return cfgErr
+		}
+		if err := config.Require(filesDir, "file storage directory"); err != nil {
+			return err
+		}
+
+		fromId, fromErr := strconv.ParseInt(args[2], 10, 0)
+		toId, toErr := strconv.ParseInt(args[3], 10, 0)
+		if fromErr != nil || toErr != nil || fromId < 0 || toId < 0 {
+			return subcmd.UsageError("Version IDs must be positive integers.")
+		}
+
+		result, err := DiffRepoVersions(repoDir, filesDir, int(fromId), int(toId))
+		if err != nil {
+			return err
+		}
+
+		subcmd.PrintResult(result)
+		return nil
+	}
+}
+
+// FileChange holds information about a single file that differs between two versions.
+type FileChange struct {
+	Path string
+
+	// MD5 sums and permissions of the file in the old and new versions. The old values are blank for added files and the new values are blank for removed files.
+	OldMD5   string `json:",omitempty"`
+	NewMD5   string `json:",omitempty"`
+	OldPerms int    `json:",omitempty"`
+	NewPerms int    `json:",omitempty"`
+
+	// Size is the size in bytes of the file a client would need to download, or -1 if it isn't known. It is 0 for removed files and files whose contents didn't change.
+	Size int64
+}
+
+// VersionDiff holds the differences between two versions' file lists.
+type VersionDiff struct {
+	FromId int
+	ToId   int
+
+	Added        []FileChange
+	Removed      []FileChange
+	Modified     []FileChange
+	PermsChanged []FileChange
+
+	// DownloadSize is the total number of bytes a client would need to download to go from the old version to the new one.
+	DownloadSize int64
+
+	// UnknownSizes is the number of files that need downloading whose size couldn't be determined. These aren't included in DownloadSize.
+	UnknownSizes int
+}
+
+// DiffRepoVersions loads the two given versions from the given repository and compares them.
+func DiffRepoVersions(repoDir, filesDir string, fromId, toId int) (VersionDiff, subcmd.Error) {
+	errFmt := fmt.Sprintf("Can't compare versions %d and %d in repository '%s': %%s", fromId, toId, repoDir)
+
+	if err := repoutil.CheckRepoDir(repoDir); err != nil {
+		return VersionDiff{}, subcmd.WrapError(errFmt, err)
+	}
+
+	fromVersion, fromErr := repoutil.LoadVersion(repoDir, fromId)
+	if fromErr != nil {
+		return VersionDiff{}, subcmd.WrapError(errFmt, fromErr)
+	}
+
+	toVersion, toErr := repoutil.LoadVersion(repoDir, toId)
+	if toErr != nil {
+		return VersionDiff{}, subcmd.WrapError(errFmt, toErr)
+	}
+
+	return DiffVersions(fromVersion.Version, toVersion.Version, filesDir), nil
+}
+
+// DiffVersions compares the file lists of the two given versions. Files are matched up by their install paths.
+// If filesDir isn't blank, it is used to look up the sizes of files that need downloading.
+func DiffVersions(from, to repo.Version, filesDir string) VersionDiff {
+	result := VersionDiff{FromId: from.Id, ToId: to.Id, Added: []FileChange{}, Removed: []FileChange{}, Modified: []FileChange{}, PermsChanged: []FileChange{}}
+
+	fromFiles := map[string]repo.FileInfo{}
+	for _, file := range from.Files {
+		fromFiles[file.Path] = file
+	}
+
+	toFiles := map[string]repo.FileInfo{}
+	for _, file := range to.Files {
+		toFiles[file.Path] = file
+	}
+
+	for _, newFile := range to.Files {
+		oldFile, existed := fromFiles[newFile.Path]
+		switch {
+		case !existed:
+			change := FileChange{Path: newFile.Path, NewMD5: newFile.MD5, NewPerms: newFile.Perms}
+			change.Size = result.addDownload(newFile, filesDir)
+			result.Added = append(result.Added, change)
+		case oldFile.MD5 != newFile.MD5:
+			change := FileChange{Path: newFile.Path, OldMD5: oldFile.MD5, NewMD5: newFile.MD5, OldPerms: oldFile.Perms, NewPerms: newFile.Perms}
+			change.Size = result.addDownload(newFile, filesDir)
+			result.Modified = append(result.Modified, change)
+		case oldFile.Perms != newFile.Perms:
+			result.PermsChanged = append(result.PermsChanged, FileChange{Path: newFile.Path, OldMD5: oldFile.MD5, NewMD5: newFile.MD5, OldPerms: oldFile.Perms, NewPerms: newFile.Perms})
+		}
+	}
+
+	for _, oldFile := range from.Files {
+		if _, exists := toFiles[oldFile.Path]; !exists {
+			result.Removed = append(result.Removed, FileChange{Path: oldFile.Path, OldMD5: oldFile.MD5, OldPerms: oldFile.Perms})
+		}
+	}
+
+	for _, list := range [][]FileChange{result.Added, result.Removed, result.Modified, result.PermsChanged} {
+		sortChanges(list)
+	}
+
+	return result
+}
+
+// addDownload looks up the size of the given file and adds it to the diff's download size.
+func (result *VersionDiff) addDownload(file repo.FileInfo, filesDir string) int64 {
+	size := int64(-1)
+	if filesDir != "" {
+		size = repoutil.StoredFileSize(filesDir, file)
+	}
+
+	if size < 0 {
+		result.UnknownSizes++
+	} else {
+		result.DownloadSize += size
+	}
+	return size
+}
+
+func sortChanges(list []FileChange) {
+	sort.Slice(list, func(i, j int) bool { return list[i].Path < list[j].Path })
+}
+
+// PrintText prints a human-readable summary of the diff.
+func (result VersionDiff) PrintText(w io.Writer) {
+	fmt.Fprintf(w, "Changes from version %d to version %d:\n", result.FromId, result.ToId)
+
+	for _, change := range result.Added {
+		fmt.Fprintf(w, "  A %s (%s)\n", change.Path, repoutil.FormatSize(change.Size))
+	}
+	for _, change := range result.Removed {
+		fmt.Fprintf(w, "  D %s\n", change.Path)
+	}
+	for _, change := range result.Modified {
+		fmt.Fprintf(w, "  M %s (%s)\n", change.Path, repoutil.FormatSize(change.Size))
+	}
+	for _, change := range result.PermsChanged {
+		fmt.Fprintf(w, "  P %s (%s -> %s)\n", change.Path, os.FileMode(change.OldPerms), os.FileMode(change.NewPerms))
+	}
+
+	fmt.Fprintf(w, "%d added, %d removed, %d modified, %d permission changes.\n", len(result.Added), len(result.Removed), len(result.Modified), len(result.PermsChanged))
+	fmt.Fprintf(w, "Download size: %s", repoutil.FormatSize(result.DownloadSize))
+	if result.UnknownSizes > 0 {
+		fmt.Fprintf(w, " (plus %d files of unknown size)", result.UnknownSizes)
+	}
+	fmt.Fprintln(w)
+}
@@ -0,0 +1,77 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/MultiMC/GoUpdate/repo"
+)
+
+func file(path, md5 string, perms int) repo.FileInfo {
+	return repo.FileInfo{Path: path, MD5: md5, Perms: perms, Sources: []repo.FileSource{{SourceType: "http", Url: "http://example.com/files/" + md5}}}
+}
+
+func TestDiffVersions(t *testing.T) {
+	filesDir := t.TempDir()
+	for name, size := range map[string]int{"new": 10, "changed": 100} {
+		if err := ioutil.WriteFile(filepath.Join(filesDir, name), make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	from := repo.Version{Id: 1, Files: []repo.FileInfo{file("same", "same", 0644), file("gone", "gone", 0644), file("edited", "old", 0644), file("script", "script", 0644)}}
+	to := repo.Version{Id: 2, Files: []repo.FileInfo{file("same", "same", 0644), file("added", "new", 0644), file("edited", "changed", 0644), file("script", "script", 0755), file("unstored", "missing", 0644)}}
+
+	got := DiffVersions(from, to, filesDir)
+	want := VersionDiff{
+		FromId:       1,
+		ToId:         2,
+		Added:        []FileChange{{Path: "added", NewMD5: "new", NewPerms: 0644, Size: 10}, {Path: "unstored", NewMD5: "missing", NewPerms: 0644, Size: -1}},
+		Removed:      []FileChange{{Path: "gone", OldMD5: "gone", OldPerms: 0644}},
+		Modified:     []FileChange{{Path: "edited", OldMD5: "old", NewMD5: "changed", OldPerms: 0644, NewPerms: 0644, Size: 100}},
+		PermsChanged: []FileChange{{Path: "script", OldMD5: "script", NewMD5: "script", OldPerms: 0644, NewPerms: 0755}},
+		DownloadSize: 110,
+		UnknownSizes: 1,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got diff\n%+v\nwant\n%+v", got, want)
+	}
+
+	// Without file storage, every download's size is unknown.
+	if noStorage := DiffVersions(from, to, ""); noStorage.DownloadSize != 0 || noStorage.UnknownSizes != 3 {
+		t.Errorf("diff without storage has download size %d and %d unknown sizes, want 0 and 3", noStorage.DownloadSize, noStorage.UnknownSizes)
+	}
+}
+
+func TestDiffIdenticalVersions(t *testing.T) {
+	version := repo.Version{Id: 1, Files: []repo.FileInfo{file("a", "a", 0644)}}
+	got := DiffVersions(version, version, "")
+	if len(got.Added)+len(got.Removed)+len(got.Modified)+len(got.PermsChanged) != 0 || got.DownloadSize != 0 || got.UnknownSizes != 0 {
+		t.Errorf("comparing a version with itself found changes: %+v", got)
+	}
+}
+
+func TestExecuteRejectsBadIds(t *testing.T) {
+	for _, ids := range [][2]string{{"-1", "2"}, {"1", "-2"}, {"one", "2"}} {
+		err := Command{}.Execute(t.TempDir(), t.TempDir(), ids[0], ids[1])
+		if err == nil || !err.ShowUsage() {
+			t.Errorf("diff %s %s returned %v, want a usage error", ids[0], ids[1], err)
+		}
+	}
+}
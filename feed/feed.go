@@ -0,0 +1,297 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+feed generates Atom and JSON feeds listing the versions each of a repository's channels has pointed at, and contains the Command struct for repoman's "feeds" subcommand.
+*/
+
+package feed
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/MultiMC/repoman/logging"
+	"github.com/MultiMC/repoman/repoutil"
+	"github.com/MultiMC/repoman/subcmd"
+)
+
+var log = logging.New("feed")
+
+// FeedDirName is the name of the directory in the repository directory that feeds are written to.
+const FeedDirName = "feeds"
+
+// FeedFailedExitCode is the exit code used when a repository was changed successfully but its feeds couldn't be regenerated.
+const FeedFailedExitCode = 60
+
+type Command struct{}
+
+func (cmd Command) Summary() string { return "Regenerates a repository's channel feeds." }
+func (cmd Command) Description() string {
+	return "Regenerates the Atom and JSON feeds for each of the given repository's channels. The feeds are normally regenerated automatically whenever a command changes the repository."
+}
+func (cmd Command) Usage() string { return "REPO_DIR" }
+func (cmd Command) ArgHelp() string {
+	return "REPO_DIR - The repository directory to regenerate the feeds of."
+}
+func (cmd Command) SetFlags(flags *flag.FlagSet) { repoutil.AddDryRunFlag(flags) }
+
+func (cmd Command) Execute(args ...string) subcmd.Error {
+	if len(args) < 1 {
+		return subcmd.UsageError("'feeds' command requires one argument.")
+	} else {
+		return repoutil.FinishChange(args[0], repoutil.WithLock(args[0], func() subcmd.Error {
+			return Regenerate(args[0])
+		}))
+	}
+}
+
+// entry is a version that a channel has pointed at.
+type entry struct {
+	VersionId   int
+	VersionName string
+
+	// Published is when the version was released, and Updated is when the channel was last pointed at it.
+	Published time.Time
+	Updated   time.Time
+
+	Notes string
+}
+
+// FeedPaths returns the paths, relative to the repository directory, of the Atom and JSON feeds for the given channel.
+func FeedPaths(chanId string) (atomPath, jsonPath string) {
+	return path.Join(FeedDirName, chanId+".atom"), path.Join(FeedDirName, chanId+".json")
+}
+
+// Regenerate rewrites the Atom and JSON feeds for every channel in the given repository.
+// If this fails, the returned error uses FeedFailedExitCode, since it is usually called after the repository has already been changed. Errors reading the index or channel history are kept as its cause.
+func Regenerate(repoDir string) subcmd.Error {
+	errFmt := fmt.Sprintf("Failed to regenerate the channel feeds for repository '%s': %%s", repoDir)
+
+	indexData, err := repoutil.LoadIndex(repoDir)
+	if err != nil {
+		return subcmd.CausedError(fmt.Sprintf(errFmt, "Couldn't read the index."), FeedFailedExitCode, err)
+	}
+
+	history, err := repoutil.LoadHistory(repoDir)
+	if err != nil {
+		return subcmd.CausedError(fmt.Sprintf(errFmt, "Couldn't read the channel history."), FeedFailedExitCode, err)
+	}
+
+	if repoutil.DryRun {
+		repoutil.DryRunf("regenerate the feeds of %d channels in %s.", len(indexData.Channels), FeedDirName)
+		return nil
+	}
+
+	if mkErr := os.MkdirAll(path.Join(repoDir, FeedDirName), 0755); mkErr != nil {
+		return subcmd.CausedError(fmt.Sprintf(errFmt, "Couldn't create the feed directory."), FeedFailedExitCode, mkErr)
+	}
+
+	// Remove the feeds of channels that no longer exist.
+	current := map[string]bool{}
+	for _, channel := range indexData.Channels {
+		atomPath, jsonPath := FeedPaths(channel.Id)
+		current[atomPath] = true
+		current[jsonPath] = true
+	}
+	if files, readErr := ioutil.ReadDir(path.Join(repoDir, FeedDirName)); readErr == nil {
+		for _, file := range files {
+			if feedPath := path.Join(FeedDirName, file.Name()); !current[feedPath] {
+				os.Remove(path.Join(repoDir, feedPath))
+			}
+		}
+	}
+
+	for _, channel := range indexData.Channels {
+		// Channels created before IDs were checked might have IDs that would put their feeds outside the feed directory.
+		if repoutil.CheckChannelId(channel.Id) != nil {
+			log.Warn("Not writing feeds for channel with invalid ID", "repo", repoDir, "channel", channel.Id)
+			continue
+		}
+		entries := channelEntries(repoDir, indexData, history, channel.Id, channel.CurrentVersion)
+		atomPath, jsonPath := FeedPaths(channel.Id)
+
+		atomData, _ := xml.MarshalIndent(atomFeed(channel.Id, channel.Name, entries), "", "  ")
+		if writeErr := ioutil.WriteFile(path.Join(repoDir, atomPath), append([]byte(xml.Header), atomData...), 0644); writeErr != nil {
+			return subcmd.CausedError(fmt.Sprintf(errFmt, fmt.Sprintf("Couldn't write %s.", atomPath)), FeedFailedExitCode, writeErr)
+		}
+
+		jsonData, _ := json.MarshalIndent(jsonFeed(channel.Name, entries), "", "  ")
+		if writeErr := ioutil.WriteFile(path.Join(repoDir, jsonPath), jsonData, 0644); writeErr != nil {
+			return subcmd.CausedError(fmt.Sprintf(errFmt, fmt.Sprintf("Couldn't write %s.", jsonPath)), FeedFailedExitCode, writeErr)
+		}
+	}
+
+	return nil
+}
+
+// channelEntries builds the list of versions the given channel has pointed at from the channel history, newest first.
+// If the channel has no history at all, its current version is used as its only entry.
+func channelEntries(repoDir string, indexData repoutil.Index, history []repoutil.ChannelChange, chanId string, currentVersion int) []entry {
+	lastPointed := map[int]time.Time{}
+	for _, change := range history {
+		if change.Channel == chanId && change.NewVersion >= 0 {
+			lastPointed[change.NewVersion] = change.Time
+		}
+	}
+	if len(lastPointed) <= 0 {
+		lastPointed[currentVersion] = time.Time{}
+	}
+
+	names := map[int]string{}
+	for _, version := range indexData.Versions {
+		names[version.Id] = version.Name
+	}
+
+	entries := []entry{}
+	for versionId, pointed := range lastPointed {
+		name, ok := names[versionId]
+		if !ok {
+			// The version has been removed from the repository since the channel pointed at it.
+			continue
+		}
+
+		e := entry{VersionId: versionId, VersionName: name, Published: indexData.VersionInfo[versionId].ReleaseTime, Updated: pointed}
+		if version, err := repoutil.LoadVersion(repoDir, versionId); err == nil {
+			e.Notes = version.ReleaseNotes
+		}
+
+		// Versions from before RepoMan kept metadata have no release time, and channels from before it kept history have no change time. Use whichever one we have.
+		if e.Published.IsZero() {
+			e.Published = e.Updated
+		}
+		if e.Updated.IsZero() {
+			e.Updated = e.Published
+		}
+
+		entries = append(entries, e)
+	}
+
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].Updated.Equal(entries[j].Updated) {
+			return entries[i].Updated.After(entries[j].Updated)
+		}
+		return entries[i].VersionId > entries[j].VersionId
+	})
+	return entries
+}
+
+// entryId returns a unique ID for the given channel's entry for the given version.
+func entryId(chanId string, versionId int) string {
+	return fmt.Sprintf("tag:repoman,2013:%s/%d", chanId, versionId)
+}
+
+//////////////////////////////
+///////// ATOM FEEDS /////////
+//////////////////////////////
+
+type atomText struct {
+	Type string `xml:"type,attr,omitempty"`
+	Body string `xml:",chardata"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr"`
+	Type string `xml:"type,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	Id        string    `xml:"id"`
+	Title     string    `xml:"title"`
+	Link      atomLink  `xml:"link"`
+	Published string    `xml:"published,omitempty"`
+	Updated   string    `xml:"updated"`
+	Content   *atomText `xml:"content,omitempty"`
+}
+
+type atom struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Id      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Author  string      `xml:"author>name"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+func atomTime(t time.Time) string {
+	if t.IsZero() {
+		t = time.Unix(0, 0)
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+func atomFeed(chanId, chanName string, entries []entry) atom {
+	feed := atom{Id: fmt.Sprintf("tag:repoman,2013:%s", chanId), Title: chanName, Author: "RepoMan", Entries: []atomEntry{}}
+
+	var updated time.Time
+	for _, e := range entries {
+		// Atom requires entries without content to have an alternate link, so every entry links to its version file. The link is relative to the feed, which is in FeedDirName.
+		link := atomLink{Rel: "alternate", Type: "application/json", Href: "../" + repoutil.VersionFileName(e.VersionId)}
+		ae := atomEntry{Id: entryId(chanId, e.VersionId), Title: e.VersionName, Link: link, Published: atomTime(e.Published), Updated: atomTime(e.Updated)}
+		if e.Notes != "" {
+			ae.Content = &atomText{Type: "text", Body: e.Notes}
+		}
+		feed.Entries = append(feed.Entries, ae)
+
+		if e.Updated.After(updated) {
+			updated = e.Updated
+		}
+	}
+	feed.Updated = atomTime(updated)
+
+	return feed
+}
+
+//////////////////////////////
+///////// JSON FEEDS /////////
+//////////////////////////////
+
+type jsonItem struct {
+	Id            string `json:"id"`
+	Title         string `json:"title"`
+	ContentText   string `json:"content_text"`
+	DatePublished string `json:"date_published,omitempty"`
+	DateModified  string `json:"date_modified,omitempty"`
+}
+
+type jsonFeedData struct {
+	Version string     `json:"version"`
+	Title   string     `json:"title"`
+	Items   []jsonItem `json:"items"`
+}
+
+func jsonFeed(chanName string, entries []entry) jsonFeedData {
+	feed := jsonFeedData{Version: "https://jsonfeed.org/version/1.1", Title: chanName, Items: []jsonItem{}}
+
+	for _, e := range entries {
+		item := jsonItem{Id: fmt.Sprintf("%d", e.VersionId), Title: e.VersionName, ContentText: e.Notes}
+		if !e.Published.IsZero() {
+			item.DatePublished = e.Published.UTC().Format(time.RFC3339)
+		}
+		if !e.Updated.IsZero() {
+			item.DateModified = e.Updated.UTC().Format(time.RFC3339)
+		}
+		feed.Items = append(feed.Items, item)
+	}
+
+	return feed
+}
@@ -0,0 +1,70 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package feed
+
+import (
+	"encoding/xml"
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/MultiMC/repoman/repoutil"
+	"github.com/MultiMC/repoman/repoutil/repotest"
+)
+
+// Every Atom entry needs either content or an alternate link, so entries link to their version file whether or not they have notes.
+func TestAtomEntriesLinkToVersions(t *testing.T) {
+	indexData := repotest.Index([]int{1, 2}, map[string]int{"stable": 2})
+	repoDir := repotest.Repo(t, &indexData, 1, 2)
+	if err := ioutil.WriteFile(path.Join(repoDir, repoutil.VersionFileName(2)), []byte(`{"ReleaseNotes": "Fixes things."}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, change := range []repoutil.ChannelChange{{Channel: "stable", OldVersion: -1, NewVersion: 1}, {Channel: "stable", OldVersion: 1, NewVersion: 2}} {
+		if err := repoutil.RecordChannelChange(repoDir, change); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := Regenerate(repoDir); err != nil {
+		t.Fatal(err)
+	}
+	atomPath, _ := FeedPaths("stable")
+	atomData, err := ioutil.ReadFile(path.Join(repoDir, atomPath))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written atom
+	if err := xml.Unmarshal(atomData, &written); err != nil {
+		t.Fatalf("feed isn't valid XML: %s", err)
+	}
+
+	if len(written.Entries) != 2 {
+		t.Fatalf("feed has %d entries, want 2", len(written.Entries))
+	}
+	for _, e := range written.Entries {
+		versionId := 1
+		if strings.HasSuffix(e.Id, "/2") {
+			versionId = 2
+		}
+		want := atomLink{Rel: "alternate", Type: "application/json", Href: "../" + repoutil.VersionFileName(versionId)}
+		if e.Link != want {
+			t.Errorf("entry %s links to %+v, want %+v", e.Id, e.Link, want)
+		}
+		if hasNotes := e.Content != nil; hasNotes != (versionId == 2) {
+			t.Errorf("entry %s has content %v", e.Id, e.Content)
+		}
+	}
+}
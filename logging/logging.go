@@ -0,0 +1,185 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+logging contains RepoMan's leveled, structured logger. Each entry has a level, the part of RepoMan that logged it, a message, and any number of key/value fields.
+
+Entries are printed to standard error if their level is at least the one picked by the global -v and -q options: notices and warnings normally, info with -v, debug with -v -v, and nothing with -q.
+In JSON output mode, they are printed as one JSON object per line. Every entry, whatever its level, is also appended to the log file given with the global --log-file option.
+*/
+package logging
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MultiMC/repoman/subcmd"
+)
+
+// Level is how important a log entry is.
+type Level int
+
+const (
+	Debug Level = iota
+	Info
+	Notice
+	Warn
+	Error
+)
+
+var levelNames = map[Level]string{Debug: "debug", Info: "info", Notice: "notice", Warn: "warn", Error: "error"}
+
+func (level Level) String() string {
+	return levelNames[level]
+}
+
+var (
+	// lock serializes writes, since the daemon logs from several goroutines.
+	lock sync.Mutex
+
+	// file is the log file, or nil if there is none.
+	file *os.File
+)
+
+// OpenFile starts appending every log entry to the file at the given path, creating it if it doesn't exist.
+func OpenFile(path string) error {
+	lock.Lock()
+	defer lock.Unlock()
+
+	newFile, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if file != nil {
+		file.Close()
+	}
+	file = newFile
+	return nil
+}
+
+// Close closes the log file, if there is one.
+func Close() {
+	lock.Lock()
+	defer lock.Unlock()
+
+	if file != nil {
+		file.Close()
+		file = nil
+	}
+}
+
+// consoleLevel returns the lowest level of entries that are printed to standard error, or a level above Error if none are.
+func consoleLevel() Level {
+	switch {
+	case subcmd.Verbosity < 0:
+		return Error + 1
+	case subcmd.Verbosity == 0:
+		return Notice
+	case subcmd.Verbosity == 1:
+		return Info
+	default:
+		return Debug
+	}
+}
+
+// Logger logs entries for one part of RepoMan, such as a command.
+type Logger struct {
+	component string
+}
+
+// New returns a Logger for the part of RepoMan with the given name.
+func New(component string) Logger {
+	return Logger{component}
+}
+
+// Debug logs the details of what is being done, such as each file that is looked at.
+// fields are alternating keys and values, as in log.Debug("Hashed file", "path", path, "md5", sum).
+func (log Logger) Debug(msg string, fields ...interface{}) { log.write(Debug, msg, fields) }
+
+// Info logs the steps of a command and the changes it makes.
+func (log Logger) Info(msg string, fields ...interface{}) { log.write(Info, msg, fields) }
+
+// Notice logs what a user waiting on a long command wants to see without asking for -v, such as progress.
+func (log Logger) Notice(msg string, fields ...interface{}) { log.write(Notice, msg, fields) }
+
+// Warn logs problems that don't stop the command.
+func (log Logger) Warn(msg string, fields ...interface{}) { log.write(Warn, msg, fields) }
+
+// Error logs problems that stop the command.
+func (log Logger) Error(msg string, fields ...interface{}) { log.write(Error, msg, fields) }
+
+func (log Logger) write(level Level, msg string, fields []interface{}) {
+	showConsole := level >= consoleLevel()
+
+	lock.Lock()
+	defer lock.Unlock()
+
+	if !showConsole && file == nil {
+		return
+	}
+
+	now := time.Now().UTC()
+	if file != nil {
+		fmt.Fprintln(file, log.text(now, level, msg, fields))
+	}
+	if showConsole {
+		if subcmd.JSON() {
+			writeJSON(os.Stderr, log.entry(now, level, msg, fields))
+		} else {
+			fmt.Fprintln(os.Stderr, log.text(now, level, msg, fields))
+		}
+	}
+}
+
+// text formats an entry as a line of text, with its fields as key=value pairs. Values with spaces or quotes in them are quoted.
+func (log Logger) text(now time.Time, level Level, msg string, fields []interface{}) string {
+	line := fmt.Sprintf("%s %-5s %s: %s", now.Format(time.RFC3339), strings.ToUpper(level.String()), log.component, msg)
+	for i := 0; i < len(fields); i += 2 {
+		value := ""
+		if i+1 < len(fields) {
+			value = fmt.Sprint(fields[i+1])
+		}
+		if value == "" || strings.ContainsAny(value, " \t\n\"=") {
+			value = fmt.Sprintf("%q", value)
+		}
+		line += fmt.Sprintf(" %v=%s", fields[i], value)
+	}
+	return line
+}
+
+// entry returns an entry as a map for marshalling to JSON. The fields are included alongside the time, level, component, and message.
+func (log Logger) entry(now time.Time, level Level, msg string, fields []interface{}) map[string]interface{} {
+	entry := map[string]interface{}{}
+	for i := 0; i+1 < len(fields); i += 2 {
+		entry[fmt.Sprint(fields[i])] = fields[i+1]
+	}
+	entry["time"] = now.Format(time.RFC3339)
+	entry["level"] = level.String()
+	entry["component"] = log.component
+	entry["msg"] = msg
+	return entry
+}
+
+func writeJSON(w io.Writer, value interface{}) {
+	jsonData, err := json.Marshal(value)
+	if err != nil {
+		jsonData, _ = json.Marshal(map[string]string{"msg": fmt.Sprintf("Failed to marshal log entry: %s", err)})
+	}
+	fmt.Fprintln(w, string(jsonData))
+}
@@ -16,11 +16,30 @@ package main
 
 import (
 	"fmt"
+	"github.com/MultiMC/repoman/audit"
+	"github.com/MultiMC/repoman/browse"
+	"github.com/MultiMC/repoman/chanlog"
+	"github.com/MultiMC/repoman/channel"
+	"github.com/MultiMC/repoman/completion"
+	"github.com/MultiMC/repoman/config"
 	"github.com/MultiMC/repoman/create"
+	"github.com/MultiMC/repoman/daemon"
+	"github.com/MultiMC/repoman/diff"
+	"github.com/MultiMC/repoman/feed"
+	"github.com/MultiMC/repoman/logging"
+	"github.com/MultiMC/repoman/promote"
+	"github.com/MultiMC/repoman/repoutil"
+	"github.com/MultiMC/repoman/rollback"
+	"github.com/MultiMC/repoman/rollout"
+	"github.com/MultiMC/repoman/serve"
 	"github.com/MultiMC/repoman/setchan"
+	"github.com/MultiMC/repoman/simulate"
 	"github.com/MultiMC/repoman/subcmd"
 	"github.com/MultiMC/repoman/update"
+	"io"
 	"os"
+	"sort"
+	"strings"
 )
 
 var commands map[string]subcmd.Command
@@ -28,18 +47,69 @@ var commands map[string]subcmd.Command
 func main() {
 	// Initialize the command map.
 	commands = map[string]subcmd.Command{
-		"help":    helpCommand{},
-		"create":  create.Command{},
-		"update":  update.Command{},
-		"setchan": setchan.Command{},
+		"help":       helpCommand{},
+		"create":     create.Command{},
+		"update":     &update.Command{},
+		"setchan":    setchan.Command{},
+		"mkchan":     channel.CreateCommand{},
+		"editchan":   channel.EditCommand{},
+		"renamechan": channel.RenameCommand{},
+		"rmchan":     channel.DeleteCommand{},
+		"chanlog":    chanlog.Command{},
+		"audit":      &audit.Command{},
+		"rollback":   rollback.Command{},
+		"promote":    promote.Command{},
+		"rollout":    rollout.Command{},
+		"feeds":      feed.Command{},
+		"browse":     browse.Command{},
+		"serve":      &serve.Command{},
+		"daemon":     &daemon.Command{},
+		"diff":       diff.Command{},
+		"simulate":   &simulate.Command{},
 	}
 
+	// The completion commands are generated from the registry itself, so they're added once it exists.
+	commands["completion"] = completion.Command{Commands: commands}
+	commands["__complete"] = completion.CompleteCommand{Commands: commands}
+
 	// Get the command line arguments.
 	args := os.Args
 
-	// There must be at least one argument (the sub-command). If not, print the help text and exit.
+	// The global options come before the command. --config picks the configuration file for whichever command is run, --output picks the output format, -v and -q pick the verbosity, and --log-file picks a log file.
+	// Every command's flag set also has all of them except --config, so they can be given after the command too.
+	for len(args) > 1 {
+		if subcmd.SetVerbosity(args[1]) {
+			args = append([]string{args[0]}, args[2:]...)
+			continue
+		}
+
+		name, value, consumed := args[1], "", 2
+		if eq := strings.Index(name, "="); eq >= 0 {
+			name, value = name[:eq], name[eq+1:]
+		} else if len(args) > 2 {
+			value, consumed = args[2], 3
+		} else {
+			break
+		}
+
+		if name == "--config" {
+			config.Path = value
+		} else if name == "--log-file" {
+			subcmd.LogFile = value
+		} else if name == "--output" {
+			if err := subcmd.SetOutputFormat(value); err != nil {
+				fmt.Fprintf(os.Stderr, "Invalid --output option: %s.\n", err)
+				os.Exit(1)
+			}
+		} else {
+			break
+		}
+		args = append([]string{args[0]}, args[consumed:]...)
+	}
+
+	// There must be at least one argument (the sub-command). If not, print the list of commands and exit.
 	if len(args) <= 1 {
-		executeCommand(commands["help"], "help")
+		printCommandList(os.Stderr)
 		os.Exit(1)
 	}
 
@@ -48,27 +118,54 @@ func main() {
 
 	// Look up the command in the command map.
 	if cmdInfo, ok := commands[cmd]; ok {
-		// Run the command.
+		// Run the command. Commands that change the repository record it in the audit log.
+		repoutil.CurrentInvocation = repoutil.Invocation{Command: cmd, Args: args[2:]}
 		os.Exit(executeCommand(cmdInfo, cmd, args[2:]...))
 	} else {
-		// If the command doesn't exist, print the help message and exit.
-		os.Exit(executeCommand(commands["help"], "help", args[2:]...))
+		// If the command doesn't exist, print the list of commands and exit.
+		fmt.Fprintf(os.Stderr, "Unknown command '%s'.\n", cmd)
+		printCommandList(os.Stderr)
+		os.Exit(1)
 	}
 
 	return
 }
 
 // executeCommand executes the given command and returns the exit code that the process should exit with.
+// The command's options are parsed out of args before it is executed. If they ask for help, the command's help is printed instead.
 func executeCommand(cmd subcmd.Command, cmdName string, args ...string) int {
-	err := cmd.Execute(args...)
+	args, err := subcmd.ParseFlags(cmdName, cmd, args)
+	if err == subcmd.HelpRequested {
+		printCommandHelp(os.Stdout, cmdName, cmd)
+		return 0
+	}
+	if err == nil && subcmd.LogFile != "" {
+		if logErr := logging.OpenFile(subcmd.LogFile); logErr != nil {
+			err = subcmd.CausedError(fmt.Sprintf("Can't open log file %s.", subcmd.LogFile), 29, logErr)
+		}
+		defer logging.Close()
+	}
+	if err == nil {
+		err = cmd.Execute(args...)
+	}
 	if err == nil {
 		return 0
+	} else if subcmd.JSON() {
+		usage := ""
+		if err.ShowUsage() {
+			usage = fmt.Sprintf("%s %s", cmdName, subcmd.FullUsage(cmd))
+		}
+		subcmd.PrintErrorJSON(err, usage)
+		return err.ExitCode()
 	} else {
 		if err.Error() != "" {
-			fmt.Fprintf(os.Stderr, "%s\n", err.Error())
+			fmt.Fprintf(os.Stderr, "%s\n", subcmd.FormatError(err))
 		}
 		if err.ShowUsage() {
-			fmt.Fprintf(os.Stderr, "Usage: %s %s\n", cmdName, cmd.Usage())
+			fmt.Fprintf(os.Stderr, "Usage: %s %s\n", cmdName, subcmd.FullUsage(cmd))
+			if flagHelp := subcmd.FlagHelp(cmd); flagHelp != "" {
+				fmt.Fprintf(os.Stderr, "Options:\n%s\n", flagHelp)
+			}
 		}
 
 		return err.ExitCode()
@@ -79,25 +176,87 @@ func executeCommand(cmd subcmd.Command, cmdName string, args ...string) int {
 //////// HELP COMMAND ////////
 //////////////////////////////
 
+// helpWidth is the width help text is wrapped to.
+const helpWidth = 80
+
 type helpCommand struct{}
 
 func (cmd helpCommand) Summary() string {
 	return "Shows a list of available commands and information about them."
 }
 func (cmd helpCommand) Description() string {
-	return "Shows a list of available commands and information about them."
+	return "Shows a list of available commands, or the description, usage, arguments, and options of the given command. Running a command with the --help option shows the same help."
 }
-func (cmd helpCommand) Usage() string   { return "" }
-func (cmd helpCommand) ArgHelp() string { return "" }
+func (cmd helpCommand) Usage() string   { return "[COMMAND]" }
+func (cmd helpCommand) ArgHelp() string { return "COMMAND - Optional command to show help for." }
 
 func (cmd helpCommand) Execute(args ...string) subcmd.Error {
-	help := fmt.Sprintf("Usage: %s COMMAND [arg...]\n", os.Args[0])
+	if len(args) < 1 {
+		printCommandList(os.Stdout)
+		return nil
+	}
 
-	for cmdStr, cmdInfo := range commands {
-		help += fmt.Sprintf("    %-10.10s%s\n", cmdStr, cmdInfo.Summary())
+	cmdInfo, ok := commands[args[0]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command '%s'.\n", args[0])
+		printCommandList(os.Stderr)
+		return subcmd.MessageError("", 1)
 	}
+	printCommandHelp(os.Stdout, args[0], cmdInfo)
+	return nil
+}
 
-	fmt.Fprintf(os.Stderr, help)
+// printCommandList prints the usage of RepoMan itself and a summary of each command, in alphabetical order.
+func printCommandList(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s [--config FILE] [--output FORMAT] [-v|-q] [--log-file FILE] COMMAND [OPTIONS] [arg...]\n\nCommands:\n", os.Args[0])
 
-	return nil
+	names := []string{}
+	for cmdStr := range commands {
+		if !subcmd.Hidden(cmdStr) {
+			names = append(names, cmdStr)
+		}
+	}
+	sort.Strings(names)
+
+	for _, cmdStr := range names {
+		fmt.Fprintf(w, "    %-12.12s%s\n", cmdStr, commands[cmdStr].Summary())
+	}
+
+	fmt.Fprintf(w, "\nRun '%s help COMMAND' or '%s COMMAND --help' for more information about a command.\n", os.Args[0], os.Args[0])
+}
+
+// printCommandHelp prints the full help for the given command: its usage, description, arguments, and options.
+func printCommandHelp(w io.Writer, cmdName string, cmd subcmd.Command) {
+	fmt.Fprintf(w, "Usage: %s %s %s\n\n", os.Args[0], cmdName, subcmd.FullUsage(cmd))
+	fmt.Fprintf(w, "%s\n", wrapText(cmd.Description(), 0, 0))
+
+	if argHelp := cmd.ArgHelp(); argHelp != "" {
+		fmt.Fprintf(w, "\nArguments:\n%s\n", wrapText(argHelp, 4, 4))
+	}
+	if flagHelp := subcmd.FlagHelp(cmd); flagHelp != "" {
+		fmt.Fprintf(w, "\nOptions:\n%s\n", flagHelp)
+	}
+}
+
+// wrapText wraps each line of the given text to helpWidth columns. Each line is indented by indent spaces, and the lines it wraps onto by hang more.
+func wrapText(text string, indent, hang int) string {
+	wrapped := []string{}
+	for _, paragraph := range strings.Split(text, "\n") {
+		line := strings.Repeat(" ", indent)
+		lineEmpty := true
+		for _, word := range strings.Fields(paragraph) {
+			if !lineEmpty && len(line)+1+len(word) > helpWidth {
+				wrapped = append(wrapped, line)
+				line = strings.Repeat(" ", indent+hang)
+				lineEmpty = true
+			}
+			if !lineEmpty {
+				line += " "
+			}
+			line += word
+			lineEmpty = false
+		}
+		wrapped = append(wrapped, line)
+	}
+	return strings.Join(wrapped, "\n")
 }
@@ -0,0 +1,51 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWrapText(t *testing.T) {
+	long := strings.Repeat("word ", 20)
+
+	tests := []struct {
+		text         string
+		indent, hang int
+		want         string
+	}{
+		{"", 0, 0, ""},
+		{"Short text.", 0, 0, "Short text."},
+		{"Short text.", 4, 4, "    Short text."},
+		{"First line.\nSecond  line.", 2, 0, "  First line.\n  Second line."},
+		{long, 0, 0, strings.TrimSpace(strings.Repeat("word ", 16)) + "\n" + strings.TrimSpace(strings.Repeat("word ", 4))},
+		{long, 4, 4, "    " + strings.TrimSpace(strings.Repeat("word ", 15)) + "\n        " + strings.TrimSpace(strings.Repeat("word ", 5))},
+		{"REPO_DIR - " + long, 4, 4, "    REPO_DIR - " + strings.TrimSpace(strings.Repeat("word ", 13)) + "\n        " + strings.TrimSpace(strings.Repeat("word ", 7))},
+		{strings.Repeat("x", 100), 0, 0, strings.Repeat("x", 100)},
+	}
+
+	for _, test := range tests {
+		got := wrapText(test.text, test.indent, test.hang)
+		if got != test.want {
+			t.Errorf("wrapText(%q, %d, %d) =\n%s\nwant\n%s", test.text, test.indent, test.hang, got, test.want)
+		}
+		for _, line := range strings.Split(got, "\n") {
+			if len(line) > helpWidth && strings.Contains(strings.TrimSpace(line), " ") {
+				t.Errorf("wrapText(%q, %d, %d) has a line longer than %d columns: %q", test.text, test.indent, test.hang, helpWidth, line)
+			}
+		}
+	}
+}
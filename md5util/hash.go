@@ -0,0 +1,81 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package md5util
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"sort"
+)
+
+// hashes maps the names of the hash algorithms RepoMan can record to their constructors.
+var hashes = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// SupportedHash returns true if the given hash algorithm name is one HashFile can calculate.
+func SupportedHash(name string) bool {
+	_, ok := hashes[name]
+	return ok
+}
+
+// HashNames returns the names of the supported hash algorithms in alphabetical order.
+func HashNames() []string {
+	names := []string{}
+	for name := range hashes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// HashFile calculates the given hashes of the file at the given path in a single pass, and returns a map of algorithm names to hex encoded sums.
+func HashFile(path string, algorithms []string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	digests := map[string]hash.Hash{}
+	writers := []io.Writer{}
+	for _, algorithm := range algorithms {
+		newHash, ok := hashes[algorithm]
+		if !ok {
+			return nil, fmt.Errorf("unknown hash algorithm %s", algorithm)
+		}
+		digests[algorithm] = newHash()
+		writers = append(writers, digests[algorithm])
+	}
+
+	if _, err := io.Copy(io.MultiWriter(writers...), file); err != nil {
+		return nil, err
+	}
+
+	sums := map[string]string{}
+	for algorithm, digest := range digests {
+		sums[algorithm] = fmt.Sprintf("%x", digest.Sum(nil))
+	}
+	return sums, nil
+}
@@ -22,14 +22,27 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+
+	"github.com/MultiMC/repoman/logging"
 )
 
+var log = logging.New("md5util")
+
 type FileMD5Data struct {
 	Path string
 	MD5  string
 }
 
-func recursiveMD5Impl(root, currentPath string, current os.FileInfo, skipFiles []string) (data []FileMD5Data, err error) {
+// Progress is told how far RecursiveMD5CalcProgress has got. *progress.Progress implements it.
+type Progress interface {
+	// Reader returns a reader that counts the bytes read from r as hashed.
+	Reader(r io.Reader) io.Reader
+
+	// FileDone counts a file of the given size as hashed.
+	FileDone(size int64)
+}
+
+func recursiveMD5Impl(root, currentPath string, current os.FileInfo, skipFiles []string, report Progress) (data []FileMD5Data, err error) {
 	err = nil
 	data = []FileMD5Data{}
 
@@ -41,6 +54,7 @@ func recursiveMD5Impl(root, currentPath string, current os.FileInfo, skipFiles [
 
 	for _, skip := range skipFiles {
 		if relative == skip {
+			log.Debug("Skipped file", "path", currentPath)
 			return
 		}
 	}
@@ -51,7 +65,7 @@ func recursiveMD5Impl(root, currentPath string, current os.FileInfo, skipFiles [
 		if entries, readErr := ioutil.ReadDir(currentPath); readErr == nil {
 			for _, entry := range entries {
 				// Recurse! RECURSE! RECURSE!!!
-				recurseData, recurseErr := recursiveMD5Impl(root, path.Join(currentPath, entry.Name()), entry, skipFiles)
+				recurseData, recurseErr := recursiveMD5Impl(root, path.Join(currentPath, entry.Name()), entry, skipFiles, report)
 				if recurseErr != nil {
 					err = recurseErr
 					return
@@ -72,8 +86,17 @@ func recursiveMD5Impl(root, currentPath string, current os.FileInfo, skipFiles [
 		}
 
 		digest := md5.New()
-		io.Copy(digest, file)
+		var in io.Reader = file
+		if report != nil {
+			in = report.Reader(file)
+		}
+		io.Copy(digest, in)
+		file.Close()
+		if report != nil {
+			report.FileDone(current.Size())
+		}
 		md5Data := FileMD5Data{Path: relative, MD5: fmt.Sprintf("%x", digest.Sum(nil))}
+		log.Debug("Hashed file", "path", currentPath, "md5", md5Data.MD5, "size", current.Size())
 
 		data = append(data, md5Data)
 	}
@@ -83,8 +106,14 @@ func recursiveMD5Impl(root, currentPath string, current os.FileInfo, skipFiles [
 
 // Recursively calculates MD5 sums for all of the files in the given directory. Skips any files whose path relative to the directory matches a path in the skipFiles slice.
 func RecursiveMD5Calc(path string, skipFiles []string) (data []FileMD5Data, err error) {
+	return RecursiveMD5CalcProgress(path, skipFiles, nil)
+}
+
+// RecursiveMD5CalcProgress is like RecursiveMD5Calc, but tells the given Progress about each file it hashes. report may be nil.
+func RecursiveMD5CalcProgress(path string, skipFiles []string, report Progress) (data []FileMD5Data, err error) {
 	if fileInfo, statErr := os.Stat(path); statErr == nil {
-		data, err = recursiveMD5Impl(path, path, fileInfo, skipFiles)
+		log.Debug("Hashing directory", "dir", path)
+		data, err = recursiveMD5Impl(path, path, fileInfo, skipFiles, report)
 		return
 	} else {
 		err = statErr
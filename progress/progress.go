@@ -0,0 +1,202 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+progress reports the progress of long operations, such as hashing and copying files, on standard error.
+On a terminal, progress is shown as a bar that is redrawn as the operation goes. Otherwise, or in JSON output mode, it is logged as a notice entry every LogInterval, which is shown at the default verbosity and goes wherever the other log entries go.
+*/
+package progress
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/MultiMC/repoman/logging"
+	"github.com/MultiMC/repoman/repoutil"
+	"github.com/MultiMC/repoman/subcmd"
+)
+
+var log = logging.New("progress")
+
+// LogInterval is how often progress is logged when standard error isn't a terminal.
+var LogInterval = 5 * time.Second
+
+// barInterval is how often the progress bar is redrawn.
+const barInterval = 100 * time.Millisecond
+
+// barWidth is the number of characters between the brackets of the progress bar.
+const barWidth = 30
+
+// Progress tracks how many files and bytes of an operation are done. It isn't safe for concurrent use.
+// All of its methods can be called on a nil *Progress, which reports nothing, so callers don't need to check whether progress is being shown.
+type Progress struct {
+	label      string
+	totalFiles int
+	totalBytes int64
+
+	files int
+	bytes int64
+
+	// fileBytes is the number of bytes counted for the current file so far.
+	fileBytes int64
+
+	start    time.Time
+	shown    time.Time
+	terminal bool
+
+	// displayed is true once progress has been shown. Operations that finish before that show nothing at all.
+	displayed bool
+}
+
+// New starts tracking an operation on the given number of files and bytes. The label describes the operation, such as "Hashing new version".
+// It returns nil if progress shouldn't be shown because of the global -q option. In JSON output mode, progress is always logged rather than drawn as a bar, so standard error stays machine-readable.
+func New(label string, totalFiles int, totalBytes int64) *Progress {
+	if subcmd.Verbosity < 0 {
+		return nil
+	}
+	now := time.Now()
+	return &Progress{label: label, totalFiles: totalFiles, totalBytes: totalBytes, start: now, shown: now, terminal: isTerminal(os.Stderr) && !subcmd.JSON()}
+}
+
+// Measure returns the number of regular files under the given directory and their total size, for use as the totals of New.
+// Files that can't be read are left out, since the operation will fail on them anyway.
+func Measure(dir string) (files int, bytes int64) {
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			files++
+			bytes += info.Size()
+		}
+		return nil
+	})
+	return
+}
+
+// Reader returns a reader that counts the bytes read from r as done.
+func (p *Progress) Reader(r io.Reader) io.Reader {
+	if p == nil {
+		return r
+	}
+	return &reader{r, p}
+}
+
+type reader struct {
+	r io.Reader
+	p *Progress
+}
+
+func (r *reader) Read(buf []byte) (int, error) {
+	n, err := r.r.Read(buf)
+	r.p.fileBytes += int64(n)
+	r.p.bytes += int64(n)
+	r.p.update()
+	return n, err
+}
+
+// FileDone counts a file of the given size as done. Bytes of the file that weren't read through Reader, for example because it was linked rather than copied, are counted now.
+func (p *Progress) FileDone(size int64) {
+	if p == nil {
+		return
+	}
+	if size > p.fileBytes {
+		p.bytes += size - p.fileBytes
+	}
+	p.fileBytes = 0
+	p.files++
+	p.update()
+}
+
+// Done ends the operation. If progress has been shown, the progress bar is drawn one last time and moved past, or the end of the operation is logged.
+func (p *Progress) Done() {
+	if p == nil || !p.displayed {
+		return
+	}
+	if p.terminal {
+		fmt.Fprintf(os.Stderr, "\r%s\n", p.bar())
+	} else {
+		p.log(p.label + " done")
+	}
+}
+
+// update shows the progress if it hasn't been shown recently.
+func (p *Progress) update() {
+	now := time.Now()
+	if p.terminal && now.Sub(p.shown) >= barInterval {
+		fmt.Fprintf(os.Stderr, "\r%s", p.bar())
+		p.shown, p.displayed = now, true
+	} else if !p.terminal && now.Sub(p.shown) >= LogInterval {
+		p.log(p.label)
+		p.shown, p.displayed = now, true
+	}
+}
+
+// bar returns the progress bar line.
+func (p *Progress) bar() string {
+	filled := int(p.fraction() * barWidth)
+	bar := strings.Repeat("=", filled)
+	if filled < barWidth {
+		bar += ">" + strings.Repeat(" ", barWidth-filled-1)
+	}
+	// The trailing spaces clear what's left of a longer line drawn before.
+	return fmt.Sprintf("%s [%s] %s    ", p.label, bar, p.summary())
+}
+
+// log logs the progress as a notice entry with the given message. The fields are the same numbers the progress bar shows, with sizes in bytes.
+func (p *Progress) log(msg string) {
+	rate, eta := p.rate()
+	log.Notice(msg, "percent", int(p.fraction()*100), "files", p.files, "totalFiles", p.totalFiles, "bytes", p.bytes, "totalBytes", p.totalBytes, "bytesPerSecond", rate, "eta", eta)
+}
+
+// summary returns a description of the progress: the percentage, files and bytes done, the throughput, and the estimated time left.
+func (p *Progress) summary() string {
+	rate, eta := p.rate()
+	return fmt.Sprintf("%3d%% %d/%d files, %s/%s, %s/s, ETA %s", int(p.fraction()*100), p.files, p.totalFiles, repoutil.FormatSize(p.bytes), repoutil.FormatSize(p.totalBytes), repoutil.FormatSize(rate), eta)
+}
+
+// rate returns the throughput so far in bytes per second, and the estimated time left.
+func (p *Progress) rate() (rate int64, eta string) {
+	elapsed := time.Since(p.start)
+	if elapsed > 0 {
+		rate = int64(float64(p.bytes) / elapsed.Seconds())
+	}
+
+	eta = "unknown"
+	switch {
+	case p.bytes >= p.totalBytes && p.files >= p.totalFiles:
+		eta = "0s"
+	case rate > 0:
+		eta = time.Duration(float64(p.totalBytes-p.bytes) / float64(rate) * float64(time.Second)).Round(time.Second).String()
+	}
+	return
+}
+
+// fraction returns how much of the operation is done, from 0 to 1. It goes by bytes, or by files if there are no bytes to do.
+func (p *Progress) fraction() float64 {
+	var fraction float64
+	switch {
+	case p.totalBytes > 0:
+		fraction = float64(p.bytes) / float64(p.totalBytes)
+	case p.totalFiles > 0:
+		fraction = float64(p.files) / float64(p.totalFiles)
+	default:
+		return 1
+	}
+	if fraction > 1 {
+		return 1
+	}
+	return fraction
+}
@@ -0,0 +1,121 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package progress
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/MultiMC/repoman/subcmd"
+)
+
+// captureStderr runs fn with standard error redirected to a file, which isn't a terminal, and returns what was written.
+func captureStderr(t *testing.T, fn func()) string {
+	file, err := ioutil.TempFile(t.TempDir(), "stderr")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	stderr := os.Stderr
+	os.Stderr = file
+	defer func() { os.Stderr = stderr }()
+	fn()
+
+	data, err := ioutil.ReadFile(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestLogsWhenNotATerminal(t *testing.T) {
+	interval := LogInterval
+	LogInterval = 0
+	defer func() { LogInterval = interval }()
+
+	output := captureStderr(t, func() {
+		p := New("Hashing new version", 2, 10)
+		if p == nil {
+			t.Fatal("New returned nil at the default verbosity")
+		}
+		if p.terminal {
+			t.Fatal("a regular file was taken for a terminal")
+		}
+		io.Copy(ioutil.Discard, p.Reader(strings.NewReader("12345")))
+		p.FileDone(5)
+		p.FileDone(5)
+		p.Done()
+	})
+
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) < 2 {
+		t.Fatalf("got %d progress lines, want at least 2:\n%s", len(lines), output)
+	}
+	for _, line := range lines {
+		if !strings.Contains(line, "NOTICE progress: Hashing new version") {
+			t.Errorf("line isn't a progress notice: %s", line)
+		}
+	}
+	last := lines[len(lines)-1]
+	for _, want := range []string{"Hashing new version done", "percent=100", "files=2", "totalFiles=2", "bytes=10", "eta=0s"} {
+		if !strings.Contains(last, want) {
+			t.Errorf("last line %q doesn't contain %q", last, want)
+		}
+	}
+}
+
+func TestQuietShowsNothing(t *testing.T) {
+	subcmd.Verbosity = -1
+	defer func() { subcmd.Verbosity = 0 }()
+
+	if p := New("Copying files", 1, 1); p != nil {
+		t.Errorf("New returned %+v with -q, want nil", p)
+	}
+}
+
+func TestQuickStepShowsNothing(t *testing.T) {
+	output := captureStderr(t, func() {
+		p := New("Copying files", 1, 1)
+		p.FileDone(1)
+		p.Done()
+	})
+	if output != "" {
+		t.Errorf("a step that finished before the first update printed %q", output)
+	}
+}
+
+func TestDevNullIsNotATerminal(t *testing.T) {
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer devNull.Close()
+
+	if isTerminal(devNull) {
+		t.Errorf("%s was taken for a terminal", os.DevNull)
+	}
+}
+
+// A nil Progress, as New returns with -q, must be safe to use.
+func TestNilProgress(t *testing.T) {
+	var p *Progress
+	io.Copy(ioutil.Discard, p.Reader(strings.NewReader("data")))
+	p.FileDone(4)
+	p.Done()
+}
@@ -0,0 +1,176 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+promote contains the Command struct for repoman's "promote" subcommand.
+*/
+
+package promote
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/MultiMC/repoman/publish"
+	"github.com/MultiMC/repoman/repoutil"
+	"github.com/MultiMC/repoman/setchan"
+	"github.com/MultiMC/repoman/subcmd"
+)
+
+// RulesFileName is the name of the file in the repository directory that holds the repository's promotion rules.
+const RulesFileName = "promotion.json"
+
+type Command struct{}
+
+func (cmd Command) Summary() string {
+	return "Points a channel at the version another channel currently points at."
+}
+func (cmd Command) Description() string {
+	return "Sets the target channel's current version to the source channel's current version. If the repository has a promotion rules file, the promotion must follow one of the allowed paths and the source channel must have pointed at its version for at least that path's minimum soak time."
+}
+func (cmd Command) Usage() string { return "REPO_DIR SOURCE_CHANNEL TARGET_CHANNEL [REASON]" }
+func (cmd Command) ArgHelp() string {
+	return "REPO_DIR - The repository directory containing the channels.\nSOURCE_CHANNEL - The ID of the channel to promote the version of.\nTARGET_CHANNEL - The ID of the channel to point at the source channel's version.\nREASON - Optional explanation of the promotion to record in the target channel's history."
+}
+func (cmd Command) SetFlags(flags *flag.FlagSet) {
+	repoutil.AddDryRunFlag(flags)
+	publish.AddPurgeListFlag(flags)
+}
+
+func (cmd Command) Execute(args ...string) subcmd.Error {
+	if len(args) < 3 {
+		return subcmd.UsageError("'promote' command requires at least three arguments.")
+	} else {
+		reason := ""
+		if len(args) >= 4 {
+			reason = args[3]
+		}
+		return repoutil.ChangeChannel(args[0], args[2], func() subcmd.Error {
+			return Promote(args[0], args[1], args[2], reason)
+		})
+	}
+}
+
+// Rules holds a repository's promotion rules.
+type Rules struct {
+	// Paths lists the promotions that are allowed. If it is empty, any promotion is allowed.
+	Paths []Path
+}
+
+// Path is a single allowed promotion from one channel to another.
+type Path struct {
+	From string
+	To   string
+
+	// MinSoak is the minimum amount of time the source channel must have pointed at its current version before it can be promoted, as a Go duration string (for example, "48h").
+	MinSoak string `json:",omitempty"`
+}
+
+// LoadRules reads the promotion rules of the given repository. A repository with no rules file has no rules.
+func LoadRules(repoDir string) (rules Rules, err subcmd.Error) {
+	fileData, readErr := ioutil.ReadFile(path.Join(repoDir, RulesFileName))
+	if readErr != nil {
+		switch {
+		case os.IsNotExist(readErr):
+			return
+		case os.IsPermission(readErr):
+			err = subcmd.CausedError("Can't access the repository's promotion rules file: permission denied.", 26, readErr)
+		default:
+			err = subcmd.CausedError("An unknown error occurred when trying to read the repository's promotion rules file.", -2, readErr)
+		}
+		return
+	}
+
+	if jsonErr := json.Unmarshal(fileData, &rules); jsonErr != nil {
+		err = subcmd.CausedError("The repository's promotion rules file is not valid JSON.", 18, jsonErr)
+	}
+	return
+}
+
+// Promote points the target channel at the source channel's current version, after checking the repository's promotion rules.
+func Promote(repoDir, sourceChanId, targetChanId, reason string) subcmd.Error {
+	errFmt := fmt.Sprintf("Can't promote channel '%s' to '%s' in repository '%s': %%s", sourceChanId, targetChanId, repoDir)
+
+	indexData, err := repoutil.LoadIndex(repoDir)
+	if err != nil {
+		return subcmd.WrapError(errFmt, err)
+	}
+
+	i := indexData.FindChannel(sourceChanId)
+	if i < 0 {
+		return subcmd.MessageError(fmt.Sprintf(errFmt, "No such source channel."), 16)
+	}
+	versionId := indexData.Channels[i].CurrentVersion
+
+	rules, err := LoadRules(repoDir)
+	if err != nil {
+		return subcmd.WrapError(errFmt, err)
+	}
+
+	if err := checkRules(repoDir, rules, sourceChanId, targetChanId, versionId); err != nil {
+		return subcmd.WrapError(errFmt, err)
+	}
+
+	if reason == "" {
+		reason = fmt.Sprintf("Promoted from channel '%s'.", sourceChanId)
+	}
+	return setchan.SetChan(repoDir, targetChanId, versionId, reason)
+}
+
+// checkRules makes sure that the given promotion is allowed by the given rules.
+func checkRules(repoDir string, rules Rules, sourceChanId, targetChanId string, versionId int) subcmd.Error {
+	if len(rules.Paths) <= 0 {
+		return nil
+	}
+
+	var rule *Path
+	for i := range rules.Paths {
+		if rules.Paths[i].From == sourceChanId && rules.Paths[i].To == targetChanId {
+			rule = &rules.Paths[i]
+			break
+		}
+	}
+	if rule == nil {
+		return subcmd.MessageError("The promotion rules don't allow promoting between these channels.", 48)
+	}
+
+	if rule.MinSoak == "" {
+		return nil
+	}
+
+	minSoak, parseErr := time.ParseDuration(rule.MinSoak)
+	if parseErr != nil {
+		return subcmd.CausedError(fmt.Sprintf("Invalid minimum soak time '%s' in the promotion rules.", rule.MinSoak), 18, parseErr)
+	}
+
+	// The soak time starts when the source channel was pointed at its current version.
+	history, err := repoutil.LoadHistory(repoDir)
+	if err != nil {
+		return err
+	}
+	last, ok := repoutil.LastChannelChange(history, sourceChanId)
+	if !ok || last.NewVersion != versionId {
+		return subcmd.MessageError("Can't tell how long the source channel has pointed at its current version because its history doesn't match it.", 48)
+	}
+
+	if soaked := time.Since(last.Time); soaked < minSoak {
+		return subcmd.MessageError(fmt.Sprintf("Version %d has only been on the source channel for %s. It must soak for at least %s.", versionId, soaked.Truncate(time.Minute), minSoak), 48)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package promote
+
+import (
+	"io/ioutil"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MultiMC/repoman/repoutil"
+	"github.com/MultiMC/repoman/repoutil/repotest"
+)
+
+func TestPromote(t *testing.T) {
+	// Beta may be promoted to stable once its version has soaked for two days, and dev may be promoted to beta at any time.
+	rules := `{"Paths": [{"From": "beta", "To": "stable", "MinSoak": "48h"}, {"From": "dev", "To": "beta"}]}`
+
+	tests := []struct {
+		desc     string
+		from, to string
+		// betaAge is how long ago beta was pointed at version 2.
+		betaAge time.Duration
+		// exitCode is the exit code Promote should fail with, or 0 if the promotion is allowed, and problem is part of its message.
+		exitCode int
+		problem  string
+	}{
+		{desc: "before the soak time", from: "beta", to: "stable", betaAge: time.Hour, exitCode: 48, problem: "must soak for at least 48h"},
+		{desc: "after the soak time", from: "beta", to: "stable", betaAge: 72 * time.Hour},
+		{desc: "allowed path without a soak time", from: "dev", to: "beta", betaAge: time.Hour},
+		{desc: "disallowed path", from: "stable", to: "beta", betaAge: 72 * time.Hour, exitCode: 48, problem: "don't allow promoting"},
+		{desc: "missing source channel", from: "nightly", to: "stable", betaAge: 72 * time.Hour, exitCode: 16, problem: "No such source channel"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			indexData := repotest.Index([]int{1, 2, 3}, map[string]int{"stable": 1, "beta": 2, "dev": 3})
+			repoDir := repotest.Repo(t, &indexData, 1, 2, 3)
+			if err := ioutil.WriteFile(path.Join(repoDir, RulesFileName), []byte(rules), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := repoutil.RecordChannelChange(repoDir, repoutil.ChannelChange{Channel: "beta", OldVersion: 1, NewVersion: 2, Time: time.Now().Add(-test.betaAge)}); err != nil {
+				t.Fatal(err)
+			}
+
+			err := Promote(repoDir, test.from, test.to, "")
+			if test.exitCode != 0 {
+				if err == nil || err.ExitCode() != test.exitCode || !strings.Contains(err.Error(), test.problem) {
+					t.Errorf("got %v, want exit code %d and a message mentioning %q", err, test.exitCode, test.problem)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("promotion failed: %s", err)
+			}
+
+			promoted, _ := repoutil.LoadIndex(repoDir)
+			from := promoted.Channels[promoted.FindChannel(test.from)].CurrentVersion
+			if to := promoted.Channels[promoted.FindChannel(test.to)].CurrentVersion; to != from {
+				t.Errorf("%s points at version %d after promotion, want %d", test.to, to, from)
+			}
+		})
+	}
+}
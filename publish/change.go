@@ -0,0 +1,141 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package publish
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/MultiMC/repoman/browse"
+	"github.com/MultiMC/repoman/config"
+	"github.com/MultiMC/repoman/feed"
+	"github.com/MultiMC/repoman/repoutil"
+
+	"github.com/MultiMC/GoUpdate/repo"
+)
+
+// Change describes how a command changes a repository's index, and which published files that changes.
+type Change struct {
+	Repository string
+
+	Channels        []ChannelChange
+	AddedVersions   []int
+	RemovedVersions []int
+
+	// URLs are the public URLs of the files the change creates, rewrites, or removes, in order.
+	// Files in the repository directory are under the configured RepoURLBase, or relative to the repository directory if there is none. New files in storage are under URL_BASE.
+	URLs []string
+}
+
+// ChannelChange describes how a change affects one channel.
+type ChannelChange struct {
+	Channel string
+
+	// OldVersion is the version the channel pointed at before the change, or -1 if the change creates it.
+	OldVersion int
+
+	// NewVersion is the version the channel points at after the change, or -1 if the change removes it.
+	NewVersion int
+
+	// Rollout is the staged rollout in progress on the channel after the change, if there is one.
+	Rollout *repoutil.Rollout `json:",omitempty"`
+}
+
+// DescribeChange describes the change from oldIndex to newIndex in the given repository.
+// storageURLs are the URLs of files the change adds to file storage, which can't be worked out from the index.
+func DescribeChange(repoDir string, oldIndex, newIndex repoutil.Index, storageURLs []string) Change {
+	change := Change{Repository: repoDir, Channels: []ChannelChange{}, AddedVersions: []int{}, RemovedVersions: []int{}}
+	paths := []string{repo.IndexFileName}
+	pages := []string{}
+
+	oldVersions := map[int]bool{}
+	for _, version := range oldIndex.Versions {
+		oldVersions[version.Id] = true
+	}
+	newVersions := map[int]bool{}
+	for _, version := range newIndex.Versions {
+		newVersions[version.Id] = true
+	}
+	for _, version := range newIndex.Versions {
+		if !oldVersions[version.Id] {
+			change.AddedVersions = append(change.AddedVersions, version.Id)
+			paths = append(paths, repoutil.VersionFileName(version.Id))
+			pages = append(pages, browse.VersionPagePath(version.Id))
+		}
+	}
+	for _, version := range oldIndex.Versions {
+		if !newVersions[version.Id] {
+			change.RemovedVersions = append(change.RemovedVersions, version.Id)
+			paths = append(paths, repoutil.VersionFileName(version.Id))
+			pages = append(pages, browse.VersionPagePath(version.Id))
+		}
+	}
+	versionListChanged := len(change.AddedVersions) > 0 || len(change.RemovedVersions) > 0
+
+	chanIds, _ := repoutil.ChangedIds(oldIndex, newIndex)
+	for _, chanId := range chanIds {
+		chanChange := ChannelChange{Channel: chanId, OldVersion: -1, NewVersion: -1}
+		oldName, newName := "", ""
+		if i := oldIndex.FindChannel(chanId); i >= 0 {
+			chanChange.OldVersion, oldName = oldIndex.Channels[i].CurrentVersion, oldIndex.Channels[i].Name
+		}
+		if i := newIndex.FindChannel(chanId); i >= 0 {
+			chanChange.NewVersion, newName = newIndex.Channels[i].CurrentVersion, newIndex.Channels[i].Name
+		}
+		if r, ok := newIndex.Rollouts[chanId]; ok {
+			chanChange.Rollout = &r
+		}
+		change.Channels = append(change.Channels, chanChange)
+
+		// Feeds only show the channel's name and the versions it pointed at, and the version list only shows which channels point at each version.
+		if chanChange.OldVersion != chanChange.NewVersion || oldName != newName {
+			atomPath, jsonPath := feed.FeedPaths(chanId)
+			paths = append(paths, atomPath, jsonPath)
+		}
+		if chanChange.OldVersion != chanChange.NewVersion {
+			versionListChanged = true
+		}
+	}
+
+	// Browse pages are only published once they've been rendered with the browse command.
+	if browse.Enabled(repoDir) {
+		if len(change.Channels) > 0 {
+			pages = append(pages, path.Join(browse.BrowseDirName, "index.html"))
+		}
+		if versionListChanged {
+			pages = append(pages, path.Join(browse.BrowseDirName, "versions.html"))
+		}
+		paths = append(paths, pages...)
+	}
+
+	cfg, _ := config.Load(repoDir)
+	change.URLs = []string{}
+	for _, relPath := range paths {
+		change.URLs = append(change.URLs, RepoURL(cfg.RepoURLBase, relPath))
+	}
+	change.URLs = append(change.URLs, storageURLs...)
+	sort.Strings(change.URLs)
+	return change
+}
+
+// RepoURL returns the public URL of the file at the given path, relative to the repository directory, when the repository is published at repoURLBase.
+// If repoURLBase is blank, the path is returned as is.
+func RepoURL(repoURLBase, relPath string) string {
+	if repoURLBase == "" {
+		return relPath
+	}
+	return strings.TrimSuffix(repoURLBase, "/") + "/" + relPath
+}
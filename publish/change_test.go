@@ -0,0 +1,149 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package publish
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+
+	"github.com/MultiMC/repoman/browse"
+	"github.com/MultiMC/repoman/config"
+	"github.com/MultiMC/repoman/repoutil"
+	"github.com/MultiMC/repoman/repoutil/repotest"
+)
+
+func TestDescribeChange(t *testing.T) {
+	plainDir := repotest.Repo(t, nil)
+
+	// This repository is published at a URL and keeps browse pages.
+	publishedDir := repotest.Repo(t, nil)
+	if err := ioutil.WriteFile(path.Join(publishedDir, config.FileName), []byte(`{"RepoURLBase": "http://example.com/repo/"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(path.Join(publishedDir, browse.BrowseDirName), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	base := repotest.Index([]int{1, 2}, map[string]int{"stable": 1})
+	renamed := repotest.Index([]int{1, 2}, map[string]int{"stable": 1})
+	renamed.Channels[0].Name = "Stable"
+	described := repotest.Index([]int{1, 2}, map[string]int{"stable": 1})
+	described.ChannelInfo = map[string]repoutil.ChannelInfo{"stable": {Description: "Releases"}}
+	rollingOut := repotest.Index([]int{1, 2}, map[string]int{"stable": 1})
+	rollingOut.Rollouts = map[string]repoutil.Rollout{"stable": {NewVersion: 2, PreviousVersion: 1, Percentage: 10}}
+
+	tests := []struct {
+		desc        string
+		repoDir     string
+		old, new    repoutil.Index
+		storageURLs []string
+		channels    []ChannelChange
+		added       []int
+		removed     []int
+		urls        []string
+	}{
+		{
+			desc: "set channel", repoDir: plainDir, old: base, new: repotest.Index([]int{1, 2}, map[string]int{"stable": 2}),
+			channels: []ChannelChange{{Channel: "stable", OldVersion: 1, NewVersion: 2}},
+			added:    []int{}, removed: []int{},
+			urls: []string{"feeds/stable.atom", "feeds/stable.json", "index.json"},
+		},
+		{
+			desc: "added version", repoDir: plainDir, old: base, new: repotest.Index([]int{1, 2, 3}, map[string]int{"stable": 1}),
+			storageURLs: []string{"http://files.example.com/abc-a.txt"},
+			channels:    []ChannelChange{}, added: []int{3}, removed: []int{},
+			urls: []string{"3.json", "http://files.example.com/abc-a.txt", "index.json"},
+		},
+		{
+			desc: "removed version", repoDir: plainDir, old: base, new: repotest.Index([]int{2}, map[string]int{"stable": 1}),
+			channels: []ChannelChange{}, added: []int{}, removed: []int{1},
+			urls: []string{"1.json", "index.json"},
+		},
+		{
+			// Descriptions aren't in feeds.
+			desc: "described channel", repoDir: plainDir, old: base, new: described,
+			channels: []ChannelChange{{Channel: "stable", OldVersion: 1, NewVersion: 1}},
+			added:    []int{}, removed: []int{},
+			urls: []string{"index.json"},
+		},
+		{
+			desc: "renamed channel", repoDir: plainDir, old: base, new: renamed,
+			channels: []ChannelChange{{Channel: "stable", OldVersion: 1, NewVersion: 1}},
+			added:    []int{}, removed: []int{},
+			urls: []string{"feeds/stable.atom", "feeds/stable.json", "index.json"},
+		},
+		{
+			desc: "started rollout", repoDir: plainDir, old: base, new: rollingOut,
+			channels: []ChannelChange{{Channel: "stable", OldVersion: 1, NewVersion: 1, Rollout: &repoutil.Rollout{NewVersion: 2, PreviousVersion: 1, Percentage: 10}}},
+			added:    []int{}, removed: []int{},
+			urls: []string{"index.json"},
+		},
+		{
+			desc: "created channel", repoDir: publishedDir, old: base, new: repotest.Index([]int{1, 2}, map[string]int{"stable": 1, "beta": 2}),
+			channels: []ChannelChange{{Channel: "beta", OldVersion: -1, NewVersion: 2}},
+			added:    []int{}, removed: []int{},
+			urls: []string{
+				"http://example.com/repo/browse/index.html",
+				"http://example.com/repo/browse/versions.html",
+				"http://example.com/repo/feeds/beta.atom",
+				"http://example.com/repo/feeds/beta.json",
+				"http://example.com/repo/index.json",
+			},
+		},
+		{
+			desc: "added version with browse pages", repoDir: publishedDir, old: base, new: repotest.Index([]int{1, 2, 3}, map[string]int{"stable": 1}),
+			channels: []ChannelChange{}, added: []int{3}, removed: []int{},
+			urls: []string{
+				"http://example.com/repo/3.json",
+				"http://example.com/repo/browse/versions.html",
+				"http://example.com/repo/browse/versions/3.html",
+				"http://example.com/repo/index.json",
+			},
+		},
+		{
+			desc: "unchanged", repoDir: publishedDir, old: base, new: base,
+			channels: []ChannelChange{}, added: []int{}, removed: []int{},
+			urls: []string{"http://example.com/repo/index.json"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			change := DescribeChange(test.repoDir, test.old, test.new, test.storageURLs)
+			want := Change{Repository: test.repoDir, Channels: test.channels, AddedVersions: test.added, RemovedVersions: test.removed, URLs: test.urls}
+			if !reflect.DeepEqual(change, want) {
+				t.Errorf("got\n%+v\nwant\n%+v", change, want)
+			}
+		})
+	}
+}
+
+func TestRepoURL(t *testing.T) {
+	tests := []struct {
+		base, relPath, want string
+	}{
+		{"", "index.json", "index.json"},
+		{"http://example.com/repo", "index.json", "http://example.com/repo/index.json"},
+		{"http://example.com/repo/", "feeds/stable.atom", "http://example.com/repo/feeds/stable.atom"},
+	}
+	for _, test := range tests {
+		if got := RepoURL(test.base, test.relPath); got != test.want {
+			t.Errorf("RepoURL(%q, %q) = %q, want %q", test.base, test.relPath, got, test.want)
+		}
+	}
+}
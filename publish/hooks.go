@@ -0,0 +1,156 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package publish
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/MultiMC/repoman/config"
+	"github.com/MultiMC/repoman/logging"
+	"github.com/MultiMC/repoman/repoutil"
+	"github.com/MultiMC/repoman/subcmd"
+)
+
+var log = logging.New("publish")
+
+// The stages hooks run at.
+const (
+	PreHook  = "pre"
+	PostHook = "post"
+)
+
+// HookVetoExitCode is the exit code used when a pre-hook rejects a change.
+const HookVetoExitCode = 53
+
+// HookFailedExitCode is the exit code used when a post-hook fails after a change was made.
+const HookFailedExitCode = 54
+
+// pending is the change that was last written with WriteIndex, which Refresh hasn't finished yet.
+var pending *Change
+
+// hookInput is what hooks are given on standard input.
+type hookInput struct {
+	// Hook is the stage the hook is running at, PreHook or PostHook.
+	Hook string
+
+	Change
+}
+
+// WriteIndex validates the given index, runs the repository's pre-hooks on the change from the current index to it, and writes it if none of them reject it.
+// Commands should call it instead of repoutil.WriteIndex, and call Refresh afterwards, which finishes the change.
+// storageURLs are the URLs of any files the change adds to file storage.
+func WriteIndex(repoDir string, indexData repoutil.Index, storageURLs ...string) subcmd.Error {
+	// Hooks shouldn't be asked about changes that can't be made anyway.
+	if err := repoutil.ValidateIndex(repoDir, indexData); err != nil {
+		return err
+	}
+	if err := BeginChange(repoDir, indexData, storageURLs); err != nil {
+		return err
+	}
+	return CommitIndex(repoDir, indexData)
+}
+
+// CommitIndex writes the given index for a change that BeginChange has already run the pre-hooks on, without running them again.
+// Commands that have to do work before writing the index that a pre-hook should be able to prevent, such as update transferring files, call BeginChange first and then CommitIndex.
+func CommitIndex(repoDir string, indexData repoutil.Index) subcmd.Error {
+	if err := repoutil.WriteIndex(repoDir, indexData); err != nil {
+		pending = nil
+		return err
+	}
+	return nil
+}
+
+// BeginChange runs the given repository's pre-hooks on the change from its current index to the given one, and remembers the change so Refresh can run the post-hooks once it is made.
+// It returns an error if a pre-hook rejects the change. In a dry run, the hooks are described instead of run.
+func BeginChange(repoDir string, indexData repoutil.Index, storageURLs []string) subcmd.Error {
+	// A missing or broken index just means everything in the new one is new.
+	oldIndex, _ := repoutil.LoadIndex(repoDir)
+	change := DescribeChange(repoDir, oldIndex, indexData, storageURLs)
+
+	cfg, err := config.Load(repoDir)
+	if err != nil {
+		return err
+	}
+	for _, command := range cfg.PreHooks {
+		if repoutil.DryRun {
+			repoutil.DryRunf("run pre-hook '%s'.", command)
+			continue
+		}
+		if hookErr := runHook(repoDir, PreHook, command, change); hookErr != nil {
+			return subcmd.CausedError(fmt.Sprintf("The change was rejected by pre-hook '%s'.", command), HookVetoExitCode, hookErr)
+		}
+	}
+
+	pending = &change
+	return nil
+}
+
+// finishChange finishes the change written by the last call to WriteIndex, if there is one: it records the URLs the change affected for the command's result, adds them to the purge list, and runs the given repository's post-hooks.
+// Every post-hook is run even if some fail, since the change has already been made. The error is for the first step that failed.
+func finishChange(repoDir string) subcmd.Error {
+	if pending == nil {
+		return nil
+	}
+	change := *pending
+	pending = nil
+	repoutil.SetChangedURLs(change.URLs)
+
+	cfg, err := config.Load(repoDir)
+	if err != nil {
+		return err
+	}
+	// The purge list is written first so post-hooks can hand it to purge tooling.
+	err = writePurgeList(cfg, change.URLs)
+	for _, command := range cfg.PostHooks {
+		if repoutil.DryRun {
+			repoutil.DryRunf("run post-hook '%s'.", command)
+			continue
+		}
+		if hookErr := runHook(repoDir, PostHook, command, change); hookErr != nil {
+			log.Error("Post-hook failed", "repo", repoDir, "command", command, "error", hookErr)
+			if err == nil {
+				err = subcmd.CausedError(fmt.Sprintf("The change was made, but post-hook '%s' failed.", command), HookFailedExitCode, hookErr)
+			}
+		}
+	}
+	return err
+}
+
+// runHook runs the given hook command with sh in the repository directory, giving it the change as JSON on standard input.
+// The hook's output is printed along with RepoMan's other messages. The REPOMAN_HOOK and REPOMAN_REPO_DIR environment variables tell it the stage and the repository's absolute path.
+func runHook(repoDir, stage, command string, change Change) error {
+	input, err := json.Marshal(hookInput{Hook: stage, Change: change})
+	if err != nil {
+		return err
+	}
+	absRepoDir, err := filepath.Abs(repoDir)
+	if err != nil {
+		return err
+	}
+
+	log.Info("Running hook", "repo", repoDir, "stage", stage, "command", command)
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Dir = repoDir
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = subcmd.Messages()
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), "REPOMAN_HOOK="+stage, "REPOMAN_REPO_DIR="+absRepoDir)
+	return cmd.Run()
+}
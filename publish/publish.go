@@ -0,0 +1,56 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+publish keeps the files RepoMan generates from a repository's index, such as channel feeds and browse pages, up to date after the repository changes.
+*/
+
+package publish
+
+import (
+	"github.com/MultiMC/repoman/browse"
+	"github.com/MultiMC/repoman/config"
+	"github.com/MultiMC/repoman/feed"
+	"github.com/MultiMC/repoman/subcmd"
+)
+
+// Refresh regenerates everything that is derived from the given repository's index. It should be called by every command that changes the repository, after the change has been written.
+// filesDir is the repository's file storage directory, if the command knows it, and is used to show file sizes on browse pages. If it is blank, the configured one is used, if any.
+// The change written with WriteIndex is finished afterwards by writing the purge list and running the post-hooks, even if regenerating failed, since the change has been made either way.
+func Refresh(repoDir, filesDir string) subcmd.Error {
+	err := regenerate(repoDir, filesDir)
+	if finishErr := finishChange(repoDir); err == nil {
+		err = finishErr
+	}
+	return err
+}
+
+func regenerate(repoDir, filesDir string) subcmd.Error {
+	if err := feed.Regenerate(repoDir); err != nil {
+		return err
+	}
+
+	// Browse pages are opt-in. They are only kept up to date once they've been rendered with the browse command.
+	if browse.Enabled(repoDir) {
+		if filesDir == "" {
+			// A broken configuration shouldn't stop the pages from being refreshed; they just won't show file sizes.
+			filesDir, _ = config.StorageDir(repoDir, "")
+		}
+		if err := browse.Render(repoDir, filesDir, false); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
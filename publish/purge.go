@@ -0,0 +1,86 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package publish
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/MultiMC/repoman/config"
+	"github.com/MultiMC/repoman/repoutil"
+	"github.com/MultiMC/repoman/subcmd"
+)
+
+// PurgeListExitCode is the exit code used when the purge list can't be written after a change was made.
+const PurgeListExitCode = 55
+
+// PurgeList is the file the URLs a change affects are appended to, or "-" to print them on standard output. It is set by the --purge-list option of commands that change the index.
+// If it is blank, the configured purge list is used, if any.
+var PurgeList string
+
+// AddPurgeListFlag defines the --purge-list option on the given flag set.
+func AddPurgeListFlag(flags *flag.FlagSet) {
+	flags.StringVar(&PurgeList, "purge-list", "", "Append the public URLs the change affects to `FILE`, one per line, or print them if FILE is -. Overrides the configured purge list.")
+}
+
+// writePurgeList appends the given URLs to the purge list picked by PurgeList or the given configuration. It does nothing if there is no purge list.
+// In JSON output mode, a purge list of "-" prints nothing, since the URLs are part of the command's result.
+func writePurgeList(cfg config.Config, urls []string) subcmd.Error {
+	// Pick isn't used, since "-" means standard output here rather than the configured value.
+	purgeList := PurgeList
+	if purgeList == "" {
+		purgeList = cfg.PurgeList
+	}
+	if purgeList == "" {
+		return nil
+	}
+	if cfg.RepoURLBase == "" {
+		log.Warn("No RepoURLBase is configured, so the purge list has paths relative to the repository directory", "list", purgeList)
+	}
+
+	if repoutil.DryRun {
+		repoutil.DryRunf("add %d URLs to the purge list %s:", len(urls), purgeList)
+		for _, url := range urls {
+			repoutil.PlanDetail("%s", url)
+		}
+		return nil
+	}
+
+	lines := ""
+	for _, url := range urls {
+		lines += url + "\n"
+	}
+	if purgeList == "-" {
+		if !subcmd.JSON() {
+			fmt.Fprint(os.Stdout, lines)
+		}
+		return nil
+	}
+
+	file, err := os.OpenFile(purgeList, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err == nil {
+		_, err = file.WriteString(lines)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		return subcmd.CausedError(fmt.Sprintf("The change was made, but its URLs couldn't be added to the purge list %s: %s", purgeList, strings.Join(urls, " ")), PurgeListExitCode, err)
+	}
+	log.Info("Added URLs to purge list", "list", purgeList, "urls", len(urls))
+	return nil
+}
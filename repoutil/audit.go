@@ -0,0 +1,236 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repoutil
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"time"
+
+	"github.com/MultiMC/repoman/subcmd"
+
+	"github.com/MultiMC/GoUpdate/repo"
+)
+
+// AuditFileName is the name of the file in the repository directory that every change to the repository is recorded in.
+// The file has one JSON object per line and is only ever appended to.
+const AuditFileName = "audit.log"
+
+// AuditLogExitCode is the exit code used when the audit log can't be read or parsed.
+const AuditLogExitCode = 52
+
+// Invocation describes the command that is changing a repository, as it is recorded in the audit log.
+type Invocation struct {
+	Command string
+	Args    []string
+
+	// Client is the address of the remote client that made the change through the daemon, if it was made that way.
+	Client string `json:",omitempty"`
+}
+
+// CurrentInvocation is the command being run. main sets it before running the command, and WithLock records it in the audit log.
+var CurrentInvocation Invocation
+
+// AuditEntry is an entry in a repository's audit log.
+type AuditEntry struct {
+	Time time.Time
+	User string
+	Host string
+
+	Invocation
+
+	// IndexHash is the hex SHA-256 sum of the index file after the change.
+	IndexHash string
+
+	// Channels are the IDs of the channels the change created, removed, or changed, including changes to their rollouts.
+	Channels []string
+
+	// Versions are the IDs of the versions the change added or removed, and of the versions that changed channels pointed or rolled out at before and after the change.
+	Versions []int
+}
+
+// CurrentHost returns the name of the machine RepoMan is running on, or "unknown" if it can't be determined.
+func CurrentHost() string {
+	if name, err := os.Hostname(); err == nil && name != "" {
+		return name
+	}
+	return "unknown"
+}
+
+// IndexHash returns the hex SHA-256 sum of the given repository's index file, or a blank string if it can't be read.
+func IndexHash(repoDir string) string {
+	indexData, err := ioutil.ReadFile(path.Join(repoDir, repo.IndexFileName))
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(indexData)
+	return hex.EncodeToString(sum[:])
+}
+
+// RecordAudit appends an entry for a change made by the given invocation to the given repository's audit log.
+// oldIndex is the index from before the change, which is compared with the index on disk to find the channels and versions that changed. Dry runs record nothing.
+func RecordAudit(repoDir string, invocation Invocation, oldIndex Index) subcmd.Error {
+	if DryRun {
+		return nil
+	}
+
+	entry := AuditEntry{Time: time.Now().UTC(), User: CurrentUser(), Host: CurrentHost(), Invocation: invocation}
+	if entry.Args == nil {
+		entry.Args = []string{}
+	}
+
+	entry.IndexHash = IndexHash(repoDir)
+	// A broken index just means nothing can be said about what changed in it.
+	newIndex, _ := LoadIndex(repoDir)
+	entry.Channels, entry.Versions = ChangedIds(oldIndex, newIndex)
+
+	jsonData, jsonErr := json.Marshal(entry)
+	if jsonErr != nil {
+		return subcmd.CausedError("Failed to marshal audit log entry to JSON. This probably shouldn't happen...", -1, jsonErr)
+	}
+
+	file, err := os.OpenFile(path.Join(repoDir, AuditFileName), os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err == nil {
+		// The entry is written with a single write so entries from different processes are never interleaved.
+		_, err = file.Write(append(jsonData, '\n'))
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if err != nil {
+		if os.IsPermission(err) {
+			return subcmd.CausedError("Can't write audit log: permission denied.", 45, err)
+		}
+		return subcmd.CausedError("An unknown error occurred when trying to write the audit log.", -2, err)
+	}
+	return nil
+}
+
+// LoadAudit reads the audit log of the given repository, oldest entry first. A repository with no audit log has an empty one.
+func LoadAudit(repoDir string) (entries []AuditEntry, err subcmd.Error) {
+	entries = []AuditEntry{}
+
+	fileData, readErr := ioutil.ReadFile(path.Join(repoDir, AuditFileName))
+	if readErr != nil {
+		switch {
+		case os.IsNotExist(readErr):
+			return
+		case os.IsPermission(readErr):
+			err = subcmd.CausedError("Can't access repository's audit log: permission denied.", AuditLogExitCode, readErr)
+		default:
+			err = subcmd.CausedError("An unknown error occurred when trying to read the repository's audit log.", -2, readErr)
+		}
+		return
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(fileData))
+	scanner.Buffer(nil, len(fileData)+1)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var entry AuditEntry
+		if jsonErr := json.Unmarshal(scanner.Bytes(), &entry); jsonErr != nil {
+			err = subcmd.CausedError(fmt.Sprintf("Line %d of the repository's audit log is not valid JSON.", line), AuditLogExitCode, jsonErr)
+			return
+		}
+		entries = append(entries, entry)
+	}
+	return
+}
+
+// ChangedIds returns the IDs of the channels and versions that differ between the old and new versions of an index, in order.
+func ChangedIds(oldIndex, newIndex Index) (channels []string, versions []int) {
+	chanSet := map[string]bool{}
+	versionSet := map[int]bool{}
+
+	oldVersions := map[int]bool{}
+	for _, version := range oldIndex.Versions {
+		oldVersions[version.Id] = true
+	}
+	newVersions := map[int]bool{}
+	for _, version := range newIndex.Versions {
+		newVersions[version.Id] = true
+		if !oldVersions[version.Id] {
+			versionSet[version.Id] = true
+		}
+	}
+	for id := range oldVersions {
+		if !newVersions[id] {
+			versionSet[id] = true
+		}
+	}
+
+	// channelVersion returns the version a channel points at and its rollout in the given index. ok is false if the channel doesn't exist.
+	channelVersion := func(indexData Index, chanId string) (channel repo.Channel, rollout Rollout, hasRollout bool, ok bool) {
+		i := indexData.FindChannel(chanId)
+		if i < 0 {
+			return
+		}
+		rollout, hasRollout = indexData.Rollouts[chanId]
+		return indexData.Channels[i], rollout, hasRollout, true
+	}
+
+	chanIds := map[string]bool{}
+	for _, channel := range oldIndex.Channels {
+		chanIds[channel.Id] = true
+	}
+	for _, channel := range newIndex.Channels {
+		chanIds[channel.Id] = true
+	}
+	for chanId := range chanIds {
+		oldChannel, oldRollout, hadRollout, existed := channelVersion(oldIndex, chanId)
+		newChannel, newRollout, hasRollout, exists := channelVersion(newIndex, chanId)
+		if existed == exists && oldChannel == newChannel && hadRollout == hasRollout && oldRollout == newRollout &&
+			oldIndex.ChannelInfo[chanId] == newIndex.ChannelInfo[chanId] {
+			continue
+		}
+
+		chanSet[chanId] = true
+		if existed {
+			versionSet[oldChannel.CurrentVersion] = true
+		}
+		if exists {
+			versionSet[newChannel.CurrentVersion] = true
+		}
+		if hadRollout {
+			versionSet[oldRollout.NewVersion] = true
+		}
+		if hasRollout {
+			versionSet[newRollout.NewVersion] = true
+		}
+	}
+
+	channels = []string{}
+	for chanId := range chanSet {
+		channels = append(channels, chanId)
+	}
+	sort.Strings(channels)
+
+	versions = []int{}
+	for id := range versionSet {
+		versions = append(versions, id)
+	}
+	sort.Ints(versions)
+	return
+}
@@ -0,0 +1,65 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repoutil_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/MultiMC/repoman/repoutil"
+	"github.com/MultiMC/repoman/repoutil/repotest"
+)
+
+func TestChangedIds(t *testing.T) {
+	// Every index in these tests has versions 1 to 3 unless a case adds or removes one.
+	index := func(channels map[string]int) repoutil.Index {
+		return repotest.Index([]int{1, 2, 3}, channels)
+	}
+	base := index(map[string]int{"stable": 1, "beta": 2})
+
+	described := index(map[string]int{"stable": 1, "beta": 2})
+	described.ChannelInfo = map[string]repoutil.ChannelInfo{"beta": {Description: "Testing"}}
+	rollingOut := index(map[string]int{"stable": 1, "beta": 2})
+	rollingOut.Rollouts = map[string]repoutil.Rollout{"stable": {NewVersion: 3, PreviousVersion: 1, Percentage: 10}}
+	advanced := index(map[string]int{"stable": 1, "beta": 2})
+	advanced.Rollouts = map[string]repoutil.Rollout{"stable": {NewVersion: 3, PreviousVersion: 1, Percentage: 20}}
+
+	cases := map[string]struct {
+		old, new repoutil.Index
+		channels []string
+		versions []int
+	}{
+		"unchanged":        {base, base, []string{}, []int{}},
+		"added version":    {base, repotest.Index([]int{1, 2, 3, 4}, map[string]int{"stable": 1, "beta": 2}), []string{}, []int{4}},
+		"removed version":  {base, repotest.Index([]int{1, 2}, map[string]int{"stable": 1, "beta": 2}), []string{}, []int{3}},
+		"set channel":      {base, index(map[string]int{"stable": 3, "beta": 2}), []string{"stable"}, []int{1, 3}},
+		"created channel":  {base, index(map[string]int{"stable": 1, "beta": 2, "dev": 3}), []string{"dev"}, []int{3}},
+		"removed channel":  {base, index(map[string]int{"stable": 1}), []string{"beta"}, []int{2}},
+		"described":        {base, described, []string{"beta"}, []int{2}},
+		"started rollout":  {base, rollingOut, []string{"stable"}, []int{1, 3}},
+		"advanced rollout": {rollingOut, advanced, []string{"stable"}, []int{1, 3}},
+		"new repository":   {repoutil.Index{}, base, []string{"beta", "stable"}, []int{1, 2, 3}},
+	}
+
+	for desc, c := range cases {
+		channels, versions := repoutil.ChangedIds(c.old, c.new)
+		if !reflect.DeepEqual(channels, c.channels) {
+			t.Errorf("%s: changed channels %q, want %q", desc, channels, c.channels)
+		}
+		if !reflect.DeepEqual(versions, c.versions) {
+			t.Errorf("%s: changed versions %v, want %v", desc, versions, c.versions)
+		}
+	}
+}
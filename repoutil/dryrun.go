@@ -0,0 +1,137 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repoutil
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+
+	"github.com/MultiMC/repoman/subcmd"
+)
+
+// DryRun is set by the --dry-run option of commands that change a repository.
+// While it is true, everything that would write to the repository or file storage describes the change on standard output instead, after doing all the same checks.
+var DryRun bool
+
+// AddDryRunFlag defines the --dry-run option on the given flag set.
+func AddDryRunFlag(flags *flag.FlagSet) {
+	flags.BoolVar(&DryRun, "dry-run", false, "Show what would change without changing anything.")
+}
+
+// plan collects the lines printed by DryRunf and PlanDetail, so they can be included in the command's result.
+var plan []string
+
+// DryRunf prints a description of a change that was skipped because of DryRun.
+func DryRunf(format string, args ...interface{}) {
+	planLine(fmt.Sprintf("Would "+format, args...))
+}
+
+// PlanDetail prints an indented line of detail about the change described by the last call to DryRunf.
+func PlanDetail(format string, args ...interface{}) {
+	planLine("  " + fmt.Sprintf(format, args...))
+}
+
+func planLine(line string) {
+	plan = append(plan, line)
+	fmt.Fprintln(subcmd.Messages(), line)
+}
+
+// PrintIndexChanges describes how writing the given index would change the index of the repository in the given directory.
+func PrintIndexChanges(repoDir string, indexData Index) {
+	// A missing or broken index on disk just means everything in the new one is new.
+	oldIndex, _ := LoadIndex(repoDir)
+	changes := DescribeIndexChanges(oldIndex, indexData)
+	if len(changes) == 0 {
+		DryRunf("write the index without changing it.")
+		return
+	}
+	DryRunf("write the index with these changes:")
+	for _, change := range changes {
+		PlanDetail("%s", change)
+	}
+}
+
+// DescribeIndexChanges returns a line describing each difference between the old and new versions of an index.
+// Lines start with "+" for things that were added, "-" for things that were removed, and "~" for things that were changed.
+func DescribeIndexChanges(oldIndex, newIndex Index) []string {
+	changes := []string{}
+
+	oldVersions := map[int]string{}
+	for _, version := range oldIndex.Versions {
+		oldVersions[version.Id] = version.Name
+	}
+	newVersions := map[int]string{}
+	for _, version := range newIndex.Versions {
+		newVersions[version.Id] = version.Name
+		if _, ok := oldVersions[version.Id]; !ok {
+			changes = append(changes, fmt.Sprintf("+ version %d (%s)", version.Id, version.Name))
+		}
+	}
+	for _, version := range oldIndex.Versions {
+		if _, ok := newVersions[version.Id]; !ok {
+			changes = append(changes, fmt.Sprintf("- version %d (%s)", version.Id, version.Name))
+		}
+	}
+
+	for _, channel := range newIndex.Channels {
+		oldPos := oldIndex.FindChannel(channel.Id)
+		if oldPos < 0 {
+			changes = append(changes, fmt.Sprintf("+ channel %s (%s) at version %d", channel.Id, channel.Name, channel.CurrentVersion))
+			continue
+		}
+		oldChannel := oldIndex.Channels[oldPos]
+		if oldChannel.CurrentVersion != channel.CurrentVersion {
+			changes = append(changes, fmt.Sprintf("~ channel %s: version %d -> %d", channel.Id, oldChannel.CurrentVersion, channel.CurrentVersion))
+		}
+		if oldChannel.Name != channel.Name {
+			changes = append(changes, fmt.Sprintf("~ channel %s: name '%s' -> '%s'", channel.Id, oldChannel.Name, channel.Name))
+		}
+		if oldIndex.ChannelInfo[channel.Id].Description != newIndex.ChannelInfo[channel.Id].Description {
+			changes = append(changes, fmt.Sprintf("~ channel %s: description '%s' -> '%s'", channel.Id, oldIndex.ChannelInfo[channel.Id].Description, newIndex.ChannelInfo[channel.Id].Description))
+		}
+	}
+	for _, channel := range oldIndex.Channels {
+		if newIndex.FindChannel(channel.Id) < 0 {
+			changes = append(changes, fmt.Sprintf("- channel %s (%s)", channel.Id, channel.Name))
+		}
+	}
+
+	// Map iteration order is random, so go through the rollouts' channels in order.
+	rolloutChannels := []string{}
+	for chanId := range oldIndex.Rollouts {
+		rolloutChannels = append(rolloutChannels, chanId)
+	}
+	for chanId := range newIndex.Rollouts {
+		if _, ok := oldIndex.Rollouts[chanId]; !ok {
+			rolloutChannels = append(rolloutChannels, chanId)
+		}
+	}
+	sort.Strings(rolloutChannels)
+	for _, chanId := range rolloutChannels {
+		oldRollout, hadRollout := oldIndex.Rollouts[chanId]
+		newRollout, hasRollout := newIndex.Rollouts[chanId]
+		switch {
+		case !hadRollout:
+			changes = append(changes, fmt.Sprintf("+ rollout of version %d on %s at %d%%", newRollout.NewVersion, chanId, newRollout.Percentage))
+		case !hasRollout:
+			changes = append(changes, fmt.Sprintf("- rollout of version %d on %s", oldRollout.NewVersion, chanId))
+		case oldRollout != newRollout:
+			changes = append(changes, fmt.Sprintf("~ rollout of version %d on %s: %d%% -> %d%%, paused %t -> %t", newRollout.NewVersion, chanId, oldRollout.Percentage, newRollout.Percentage, oldRollout.Paused, newRollout.Paused))
+		}
+	}
+
+	return changes
+}
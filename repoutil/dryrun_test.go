@@ -0,0 +1,70 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repoutil_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/MultiMC/repoman/repoutil"
+	"github.com/MultiMC/repoman/repoutil/repotest"
+)
+
+func TestDescribeIndexChanges(t *testing.T) {
+	check := func(old, new repoutil.Index, want ...string) {
+		t.Helper()
+		if want == nil {
+			want = []string{}
+		}
+		if changes := repoutil.DescribeIndexChanges(old, new); !reflect.DeepEqual(changes, want) {
+			t.Errorf("got %q, want %q", changes, want)
+		}
+	}
+	stable := func(versionIds ...int) repoutil.Index {
+		return repotest.Index(versionIds, map[string]int{"stable": 1})
+	}
+	base := stable(1, 2)
+
+	check(base, base)
+	check(repoutil.Index{}, repotest.Index([]int{1}, map[string]int{"stable": 1}), "+ version 1 (v)", "+ channel stable (stable) at version 1")
+
+	// Versions
+	check(base, stable(1, 2, 3), "+ version 3 (v)")
+	check(base, repotest.Index([]int{2}, map[string]int{"stable": 1}), "- version 1 (v)")
+
+	// Channels
+	check(base, repotest.Index([]int{1, 2}, map[string]int{"stable": 2}), "~ channel stable: version 1 -> 2")
+	check(base, repotest.Index([]int{1, 2}, map[string]int{"stable": 1, "beta": 2}), "+ channel beta (beta) at version 2")
+	check(base, repotest.Index([]int{1, 2}, nil), "- channel stable (stable)")
+
+	renamed := stable(1, 2)
+	renamed.Channels[0].Name = "Stable"
+	check(base, renamed, "~ channel stable: name 'stable' -> 'Stable'")
+
+	described := stable(1, 2)
+	described.ChannelInfo = map[string]repoutil.ChannelInfo{"stable": {Description: "Releases"}}
+	check(base, described, "~ channel stable: description '' -> 'Releases'")
+
+	// Rollouts
+	rollingOut := stable(1, 2)
+	rollingOut.Rollouts = map[string]repoutil.Rollout{"stable": {NewVersion: 2, PreviousVersion: 1, Percentage: 10}}
+	check(base, rollingOut, "+ rollout of version 2 on stable at 10%")
+
+	advanced := stable(1, 2)
+	advanced.Rollouts = map[string]repoutil.Rollout{"stable": {NewVersion: 2, PreviousVersion: 1, Percentage: 50, Paused: true}}
+	check(rollingOut, advanced, "~ rollout of version 2 on stable: 10% -> 50%, paused false -> true")
+
+	check(rollingOut, repotest.Index([]int{1, 2}, map[string]int{"stable": 2}), "~ channel stable: version 1 -> 2", "- rollout of version 2 on stable")
+}
@@ -0,0 +1,184 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repoutil
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/MultiMC/repoman/subcmd"
+)
+
+// HistoryFileName is the name of the file in the repository directory that channel changes are recorded in.
+const HistoryFileName = "history.json"
+
+// ChannelChange is an entry in a repository's channel history.
+type ChannelChange struct {
+	Channel string
+
+	// OldVersion is the version the channel pointed at before the change, or -1 if the channel was created by the change.
+	OldVersion int
+
+	// NewVersion is the version the channel points at after the change, or -1 if the channel was removed by the change.
+	NewVersion int
+
+	// Rollback is true if the change was made by the rollback command, undoing the most recent change before it that hadn't been rolled back already.
+	Rollback bool `json:",omitempty"`
+
+	Time   time.Time
+	User   string
+	Reason string `json:",omitempty"`
+}
+
+// LoadHistory reads the channel history of the given repository, oldest change first. A repository with no history file has an empty history.
+func LoadHistory(repoDir string) (history []ChannelChange, err subcmd.Error) {
+	history = []ChannelChange{}
+
+	fileData, readErr := ioutil.ReadFile(path.Join(repoDir, HistoryFileName))
+	if readErr != nil {
+		switch {
+		case os.IsNotExist(readErr):
+			return
+		case os.IsPermission(readErr):
+			err = subcmd.CausedError("Can't access repository's channel history file: permission denied.", 25, readErr)
+		default:
+			err = subcmd.CausedError("An unknown error occurred when trying to read the repository's channel history file.", -2, readErr)
+		}
+		return
+	}
+
+	if jsonErr := json.Unmarshal(fileData, &history); jsonErr != nil {
+		err = subcmd.CausedError("The repository's channel history file is not valid JSON.", 17, jsonErr)
+	}
+	return
+}
+
+// writeHistory replaces the channel history of the given repository with the given list of changes.
+// Like the index, the history is written to a temporary file that is then renamed over the old one, so it is never left half-written.
+func writeHistory(repoDir string, history []ChannelChange) subcmd.Error {
+	if DryRun {
+		return nil
+	}
+	jsonData, _ := json.MarshalIndent(history, "", "\t")
+
+	historyFilePath := path.Join(repoDir, HistoryFileName)
+	tempFile, err := ioutil.TempFile(filepath.Dir(historyFilePath), HistoryFileName+".tmp")
+	if err == nil {
+		_, err = tempFile.Write(jsonData)
+		if closeErr := tempFile.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil {
+			err = os.Chmod(tempFile.Name(), 0644)
+		}
+		if err == nil {
+			err = os.Rename(tempFile.Name(), historyFilePath)
+		}
+		if err != nil {
+			os.Remove(tempFile.Name())
+		}
+	}
+	if err != nil {
+		if os.IsPermission(err) {
+			return subcmd.CausedError("Can't write channel history file: permission denied.", 45, err)
+		}
+		return subcmd.CausedError("An unknown error occurred when trying to write the channel history file.", -2, err)
+	}
+	return nil
+}
+
+// RecordChannelChange adds the given change to the given repository's channel history. If the change's time or user aren't set, they are filled in with the current time and user.
+func RecordChannelChange(repoDir string, change ChannelChange) subcmd.Error {
+	history, err := LoadHistory(repoDir)
+	if err != nil {
+		return err
+	}
+
+	if change.Time.IsZero() {
+		change.Time = time.Now().UTC()
+	}
+	if change.User == "" {
+		change.User = CurrentUser()
+	}
+
+	if DryRun {
+		DryRunf("record the change of channel %s from version %d to %d in the channel history.", change.Channel, change.OldVersion, change.NewVersion)
+	}
+	return writeHistory(repoDir, append(history, change))
+}
+
+// RenameChannelHistory changes the channel ID of all history entries for the given channel so the history follows the channel when it is renamed.
+func RenameChannelHistory(repoDir, chanId, newChanId string) subcmd.Error {
+	history, err := LoadHistory(repoDir)
+	if err != nil {
+		return err
+	}
+
+	for i := range history {
+		if history[i].Channel == chanId {
+			history[i].Channel = newChanId
+		}
+	}
+
+	if DryRun {
+		DryRunf("rename channel %s to %s in the channel history.", chanId, newChanId)
+	}
+	return writeHistory(repoDir, history)
+}
+
+// LastChannelChange returns the most recent history entry for the given channel. The second return value is false if the channel has no history.
+func LastChannelChange(history []ChannelChange, chanId string) (ChannelChange, bool) {
+	for i := len(history) - 1; i >= 0; i-- {
+		if history[i].Channel == chanId {
+			return history[i], true
+		}
+	}
+	return ChannelChange{}, false
+}
+
+// RollbackTarget returns the change to the given channel that a rollback should undo: the most recent one that hasn't been undone by a later rollback.
+// Rollback entries themselves are never undone, so rolling back twice goes back two changes instead of undoing the first rollback. The second return value is false if every change has been rolled back.
+func RollbackTarget(history []ChannelChange, chanId string) (ChannelChange, bool) {
+	skip := 0
+	for i := len(history) - 1; i >= 0; i-- {
+		switch {
+		case history[i].Channel != chanId:
+			continue
+		case history[i].Rollback:
+			skip++
+		case skip > 0:
+			skip--
+		default:
+			return history[i], true
+		}
+	}
+	return ChannelChange{}, false
+}
+
+// CurrentUser returns the name of the user running RepoMan, or "unknown" if it can't be determined.
+func CurrentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	if name := os.Getenv("USER"); name != "" {
+		return name
+	}
+	return "unknown"
+}
@@ -0,0 +1,94 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repoutil_test
+
+import (
+	"testing"
+
+	"github.com/MultiMC/repoman/repoutil"
+)
+
+func TestRollbackTarget(t *testing.T) {
+	set := func(chanId string, oldVersion, newVersion int) repoutil.ChannelChange {
+		return repoutil.ChannelChange{Channel: chanId, OldVersion: oldVersion, NewVersion: newVersion}
+	}
+	rollback := func(chanId string, oldVersion, newVersion int) repoutil.ChannelChange {
+		change := set(chanId, oldVersion, newVersion)
+		change.Rollback = true
+		return change
+	}
+
+	tests := []struct {
+		desc    string
+		history []repoutil.ChannelChange
+		// rollBackTo is the version the rollback should point the channel at, -1 if the channel didn't exist before the change being undone, or -2 if there is nothing left to undo.
+		rollBackTo int
+	}{
+		{
+			desc:       "single rollback",
+			history:    []repoutil.ChannelChange{set("stable", -1, 1), set("stable", 1, 2)},
+			rollBackTo: 1,
+		},
+		{
+			desc:       "second rollback in a row",
+			history:    []repoutil.ChannelChange{set("stable", -1, 1), set("stable", 1, 2), set("stable", 2, 3), rollback("stable", 3, 2)},
+			rollBackTo: 1,
+		},
+		{
+			desc:       "third rollback in a row",
+			history:    []repoutil.ChannelChange{set("stable", -1, 1), set("stable", 1, 2), set("stable", 2, 3), set("stable", 3, 4), rollback("stable", 4, 3), rollback("stable", 3, 2)},
+			rollBackTo: 1,
+		},
+		{
+			desc:       "rollback after a set that follows a rollback",
+			history:    []repoutil.ChannelChange{set("stable", -1, 1), set("stable", 1, 2), rollback("stable", 2, 1), set("stable", 1, 3)},
+			rollBackTo: 1,
+		},
+		{
+			desc:       "changes to other channels are ignored",
+			history:    []repoutil.ChannelChange{set("stable", -1, 1), set("beta", -1, 1), set("stable", 1, 2), set("beta", 1, 3), rollback("beta", 3, 1)},
+			rollBackTo: 1,
+		},
+		{
+			desc:       "no earlier version",
+			history:    []repoutil.ChannelChange{set("stable", -1, 1)},
+			rollBackTo: -1,
+		},
+		{
+			desc:       "everything rolled back",
+			history:    []repoutil.ChannelChange{set("stable", -1, 1), set("stable", 1, 2), rollback("stable", 2, 1), set("stable", 1, 3), rollback("stable", 3, 1)},
+			rollBackTo: -1,
+		},
+		{
+			desc:       "no history",
+			history:    []repoutil.ChannelChange{set("beta", -1, 1)},
+			rollBackTo: -2,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			target, ok := repoutil.RollbackTarget(test.history, "stable")
+			switch {
+			case test.rollBackTo == -2 && ok:
+				t.Errorf("got target %+v, want none", target)
+			case test.rollBackTo != -2 && !ok:
+				t.Errorf("got no target, want one going back to version %d", test.rollBackTo)
+			case ok && target.OldVersion != test.rollBackTo:
+				t.Errorf("target %+v goes back to version %d, want %d", target, target.OldVersion, test.rollBackTo)
+			}
+		})
+	}
+}
@@ -0,0 +1,97 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repoutil
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/MultiMC/repoman/subcmd"
+)
+
+// LockFileName is the name of the file in the repository directory that is created while a command is changing the repository.
+const LockFileName = ".repoman.lock"
+
+// LockedExitCode is the exit code used when a repository can't be locked because another command is already changing it.
+const LockedExitCode = 51
+
+// LockRepo locks the given repository so that no other RepoMan process can change it until the returned unlock function is called.
+// The lock is a file in the repository directory containing the locking process's ID. If RepoMan is killed while holding the lock, the file has to be removed by hand.
+func LockRepo(repoDir string) (unlock func(), err subcmd.Error) {
+	if err = CheckRepoDir(repoDir); err != nil {
+		return
+	}
+
+	lockFilePath := path.Join(repoDir, LockFileName)
+	lockFile, openErr := os.OpenFile(lockFilePath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if openErr != nil {
+		switch {
+		case os.IsExist(openErr):
+			owner := "another process"
+			if pid, readErr := ioutil.ReadFile(lockFilePath); readErr == nil && len(pid) > 0 {
+				owner = fmt.Sprintf("process %s", strings.TrimSpace(string(pid)))
+			}
+			err = subcmd.CausedError(fmt.Sprintf("The repository is locked by %s. If no other RepoMan process is running, remove %s.", owner, lockFilePath), LockedExitCode, openErr)
+		case os.IsPermission(openErr):
+			err = subcmd.CausedError("Can't lock repository: permission denied.", 27, openErr)
+		default:
+			err = subcmd.CausedError("An unknown error occurred when trying to lock the repository.", -2, openErr)
+		}
+		return
+	}
+
+	fmt.Fprintf(lockFile, "%d\n", os.Getpid())
+	lockFile.Close()
+
+	unlock = func() { os.Remove(lockFilePath) }
+	return
+}
+
+// WithLock locks the given repository, calls fn, and unlocks the repository again, returning fn's error.
+// If fn succeeds, the change is recorded in the repository's audit log as made by CurrentInvocation before the repository is unlocked.
+// Dry runs don't change anything, so they don't take the lock either.
+func WithLock(repoDir string, fn func() subcmd.Error) subcmd.Error {
+	return WithLockAs(repoDir, CurrentInvocation, fn)
+}
+
+// WithLockAs is WithLock for changes made by the given invocation rather than the command being run, such as the daemon's requests.
+func WithLockAs(repoDir string, invocation Invocation, fn func() subcmd.Error) subcmd.Error {
+	if DryRun {
+		return fn()
+	}
+
+	unlock, err := LockRepo(repoDir)
+	if err != nil {
+		return subcmd.WrapError(fmt.Sprintf("Can't change repository '%s': %%s", repoDir), err)
+	}
+	defer unlock()
+
+	// A missing or broken index just means everything in the new one is new.
+	oldIndex, _ := LoadIndex(repoDir)
+	oldHash := IndexHash(repoDir)
+
+	err = fn()
+	// Commands can fail after writing the index, such as when the feeds can't be regenerated, and those changes are recorded too.
+	if err != nil && IndexHash(repoDir) == oldHash {
+		return err
+	}
+	if auditErr := RecordAudit(repoDir, invocation, oldIndex); err == nil {
+		err = auditErr
+	}
+	return err
+}
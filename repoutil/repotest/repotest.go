@@ -0,0 +1,69 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+repotest contains helpers for tests that work with repository indexes and directories.
+*/
+package repotest
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path"
+	"sort"
+	"testing"
+
+	"github.com/MultiMC/repoman/repoutil"
+
+	"github.com/MultiMC/GoUpdate/repo"
+)
+
+// Index returns an index with the given version IDs and channels, mapping channel IDs to the versions they point at.
+// Every version is named "v", and each channel is named after its ID. Channels are listed in order of ID, so tests don't depend on map order.
+func Index(versionIds []int, channels map[string]int) repoutil.Index {
+	indexData := repoutil.Index{Index: repo.Index{Versions: []repo.VersionSummary{}, Channels: []repo.Channel{}}}
+	for _, id := range versionIds {
+		indexData.Versions = append(indexData.Versions, repo.VersionSummary{Id: id, Name: "v"})
+	}
+
+	chanIds := []string{}
+	for chanId := range channels {
+		chanIds = append(chanIds, chanId)
+	}
+	sort.Strings(chanIds)
+	for _, chanId := range chanIds {
+		indexData.Channels = append(indexData.Channels, repo.Channel{Id: chanId, Name: chanId, CurrentVersion: channels[chanId]})
+	}
+	return indexData
+}
+
+// Repo creates a repository directory that is removed when the test ends. It writes the given index, unless it is nil, and an empty version file for each of the given version IDs.
+func Repo(t testing.TB, indexData *repoutil.Index, versionFiles ...int) string {
+	repoDir := t.TempDir()
+	for _, id := range versionFiles {
+		if err := ioutil.WriteFile(path.Join(repoDir, repoutil.VersionFileName(id)), []byte("{}"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if indexData != nil {
+		jsonData, err := json.Marshal(indexData)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path.Join(repoDir, repo.IndexFileName), jsonData, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return repoDir
+}
@@ -0,0 +1,304 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+repoutil contains functions for reading and writing the files that make up a GoUpdate repository.
+*/
+
+package repoutil
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/MultiMC/repoman/subcmd"
+
+	"github.com/MultiMC/GoUpdate/repo"
+)
+
+// CheckRepoDir makes sure that the given repository directory exists and is a directory.
+func CheckRepoDir(repoDir string) subcmd.Error {
+	if info, err := os.Stat(repoDir); err != nil {
+		var code int
+		var msg string
+		switch {
+		case os.IsNotExist(err):
+			msg = "Invalid repository: repository directory doesn't exist."
+			code = 10
+		case os.IsPermission(err):
+			msg = "Can't access repository directory: permission denied."
+			code = 20
+		default:
+			msg = "Can't access repository directory: an unknown error occurred."
+			code = -2
+		}
+		return subcmd.CausedError(msg, code, err)
+	} else if !info.IsDir() {
+		return subcmd.MessageError(fmt.Sprintf("The path %s is not a valid repository. Must be a directory.", repoDir), 10)
+	}
+	return nil
+}
+
+// Index is a repository index along with the extra information that RepoMan stores in it. GoUpdate clients ignore the extra fields.
+type Index struct {
+	repo.Index
+
+	// ChannelInfo maps channel IDs to extra information about those channels.
+	ChannelInfo map[string]ChannelInfo `json:",omitempty"`
+
+	// Rollouts maps channel IDs to the staged rollouts in progress on those channels.
+	Rollouts map[string]Rollout `json:",omitempty"`
+
+	// VersionInfo maps version IDs to a summary of those versions' metadata.
+	VersionInfo map[int]VersionSummaryMeta `json:",omitempty"`
+}
+
+// ChannelInfo holds extra information about a channel that doesn't fit in repo.Channel.
+type ChannelInfo struct {
+	Description string `json:",omitempty"`
+}
+
+// Rollout describes a staged rollout of a new version to a percentage of a channel's clients.
+// While a rollout is in progress, the channel's CurrentVersion stays at PreviousVersion so clients that don't know about rollouts keep using it.
+// Clients that do know about rollouts put themselves in a bucket from 0 to 99 and use NewVersion if their bucket is less than Percentage.
+type Rollout struct {
+	NewVersion      int
+	PreviousVersion int
+	Percentage      int
+
+	// Paused rollouts still apply to clients at their current percentage, but can't be advanced until they are resumed.
+	Paused bool `json:",omitempty"`
+}
+
+// Version is a version's data along with the extra metadata that RepoMan stores in version files. GoUpdate clients ignore the extra fields.
+type Version struct {
+	repo.Version
+	VersionMeta
+
+	// Hashes maps the install paths of the version's files to their sums under the extra hash algorithms the repository is configured to record.
+	Hashes map[string]map[string]string `json:",omitempty"`
+}
+
+// VersionMeta holds extra information about a version that doesn't fit in repo.Version.
+type VersionMeta struct {
+	// ReleaseNotes are the version's release notes in Markdown.
+	ReleaseNotes string `json:",omitempty"`
+
+	ReleaseTime time.Time
+
+	// Commit is the hash of the source control commit the version was built from.
+	Commit string `json:",omitempty"`
+
+	// Build holds arbitrary information about how the version was built, such as the build number or the name of the build machine.
+	Build map[string]string `json:",omitempty"`
+}
+
+// Summary returns the part of the metadata that is kept in the index.
+func (meta VersionMeta) Summary() VersionSummaryMeta {
+	summary := VersionSummaryMeta{ReleaseTime: meta.ReleaseTime, Commit: meta.Commit}
+	// The first non-blank line of the release notes is used as the summary.
+	for _, line := range strings.Split(meta.ReleaseNotes, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			summary.Summary = strings.TrimLeft(line, "# ")
+			break
+		}
+	}
+	return summary
+}
+
+// VersionSummaryMeta is a summary of a version's metadata that is stored in the index so tooling can show a changelog without loading every version file.
+type VersionSummaryMeta struct {
+	ReleaseTime time.Time
+	Commit      string `json:",omitempty"`
+
+	// Summary is the first line of the version's release notes.
+	Summary string `json:",omitempty"`
+}
+
+// channelIdPattern matches the characters channel IDs can be made of. Channel IDs are used in file names, so they can't contain slashes.
+var channelIdPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// CheckChannelId returns a usage error if the given channel ID can't be used for a new channel.
+// Channel IDs may only contain letters, digits, dots, underscores, and dashes, and can't be "." or "..".
+func CheckChannelId(chanId string) subcmd.Error {
+	if !channelIdPattern.MatchString(chanId) || chanId == "." || chanId == ".." {
+		return subcmd.UsageError(fmt.Sprintf("Invalid channel ID '%s'. Channel IDs may only contain letters, digits, '.', '_', and '-', and can't be '.' or '..'.", chanId))
+	}
+	return nil
+}
+
+// FindChannel returns the index of the channel with the given ID in the index's channel list, or -1 if there is no such channel.
+func (indexData Index) FindChannel(chanId string) int {
+	for i, channel := range indexData.Channels {
+		if channel.Id == chanId {
+			return i
+		}
+	}
+	return -1
+}
+
+// LoadIndex reads and unmarshals the index file of the repository in the given directory.
+func LoadIndex(repoDir string) (indexData Index, err subcmd.Error) {
+	if err = CheckRepoDir(repoDir); err != nil {
+		return
+	}
+
+	fileData, readErr := ioutil.ReadFile(path.Join(repoDir, repo.IndexFileName))
+	if readErr != nil {
+		var code int
+		var msg string
+		switch {
+		case os.IsNotExist(readErr):
+			msg = "Invalid repository: index file is missing."
+			code = 13
+		case os.IsPermission(readErr):
+			msg = "Can't access repository's index file: permission denied."
+			code = 23
+		default:
+			msg = "An unknown error occurred when trying to read the repository's index file."
+			code = -2
+		}
+		err = subcmd.CausedError(msg, code, readErr)
+		return
+	}
+
+	if jsonErr := json.Unmarshal(fileData, &indexData); jsonErr != nil {
+		err = subcmd.CausedError("Invalid repository: index file is not valid JSON.", 12, jsonErr)
+	}
+	if indexData.ChannelInfo == nil {
+		indexData.ChannelInfo = map[string]ChannelInfo{}
+	}
+	if indexData.Rollouts == nil {
+		indexData.Rollouts = map[string]Rollout{}
+	}
+	if indexData.VersionInfo == nil {
+		indexData.VersionInfo = map[int]VersionSummaryMeta{}
+	}
+	return
+}
+
+// WriteIndex validates the given index with ValidateIndex and writes it to the index file of the repository in the given directory.
+// The index is written to a temporary file first and then moved over the old index so clients never see a partially written index.
+func WriteIndex(repoDir string, indexData Index) subcmd.Error {
+	if err := ValidateIndex(repoDir, indexData); err != nil {
+		return err
+	}
+
+	if DryRun {
+		PrintIndexChanges(repoDir, indexData)
+		return nil
+	}
+
+	jsonData, jsonErr := json.Marshal(indexData)
+	if jsonErr != nil {
+		return subcmd.CausedError("Failed to marshal index data to JSON. This probably shouldn't happen...", -1, jsonErr)
+	}
+
+	indexFilePath := path.Join(repoDir, repo.IndexFileName)
+	tempFilePath := indexFilePath + ".tmp"
+
+	err := ioutil.WriteFile(tempFilePath, jsonData, 0644)
+	if err == nil {
+		err = os.Rename(tempFilePath, indexFilePath)
+	}
+	if err != nil {
+		os.Remove(tempFilePath)
+		if os.IsPermission(err) {
+			return subcmd.CausedError("Can't write index file: permission denied.", 45, err)
+		}
+		return subcmd.CausedError("An unknown error occurred when trying to write the index file.", -2, err)
+	}
+	return nil
+}
+
+// VersionFileName returns the name of the file that the version with the given ID is stored in, relative to the repository directory.
+func VersionFileName(versionId int) string {
+	return fmt.Sprintf("%d.json", versionId)
+}
+
+// LoadVersion reads and unmarshals the version file for the given version ID in the given repository.
+func LoadVersion(repoDir string, versionId int) (versionData Version, err subcmd.Error) {
+	fileData, readErr := ioutil.ReadFile(path.Join(repoDir, VersionFileName(versionId)))
+	if readErr != nil {
+		var code int
+		var msg string
+		switch {
+		case os.IsNotExist(readErr):
+			msg = fmt.Sprintf("Version %d doesn't exist: its version file is missing.", versionId)
+			code = 14
+		case os.IsPermission(readErr):
+			msg = fmt.Sprintf("Can't access the version file for version %d: permission denied.", versionId)
+			code = 24
+		default:
+			msg = fmt.Sprintf("An unknown error occurred when trying to read the version file for version %d.", versionId)
+			code = -2
+		}
+		err = subcmd.CausedError(msg, code, readErr)
+		return
+	}
+
+	if jsonErr := json.Unmarshal(fileData, &versionData); jsonErr != nil {
+		err = subcmd.CausedError(fmt.Sprintf("The version file for version %d is not valid JSON.", versionId), 15, jsonErr)
+	}
+	return
+}
+
+// StoragePath returns the path of the file in the given file storage directory that the given HTTP source points to, or an empty string if the source doesn't point into file storage.
+// RepoMan stores all files directly in the file storage directory, so the last element of the source's URL is the file's name in storage.
+func StoragePath(filesDir string, source repo.FileSource) string {
+	if source.SourceType != "http" || source.Url == "" {
+		return ""
+	}
+	return filepath.Join(filesDir, path.Base(source.Url))
+}
+
+// StoredFileSize returns the size of the file in the given file storage directory that the first HTTP source of the given file points to.
+// If the file can't be found in storage, -1 is returned.
+func StoredFileSize(filesDir string, file repo.FileInfo) int64 {
+	for _, source := range file.Sources {
+		if storagePath := StoragePath(filesDir, source); storagePath != "" {
+			if info, err := os.Stat(storagePath); err == nil {
+				return info.Size()
+			}
+		}
+	}
+	return -1
+}
+
+// FormatSize returns a human-readable string for the given number of bytes. Negative sizes are shown as unknown.
+func FormatSize(size int64) string {
+	if size < 0 {
+		return "unknown size"
+	}
+
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	value := float64(size)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+
+	if unit == 0 {
+		return fmt.Sprintf("%d %s", size, units[unit])
+	}
+	return fmt.Sprintf("%.1f %s", value, units[unit])
+}
@@ -0,0 +1,112 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repoutil
+
+import (
+	"io"
+
+	"github.com/MultiMC/repoman/subcmd"
+)
+
+// Change is the result of a command that changes a repository. Results of commands with more to say embed it.
+type Change struct {
+	Repository string
+
+	DryRun bool `json:",omitempty"`
+
+	// Plan holds the lines a dry run printed to describe what it would have changed.
+	Plan []string `json:",omitempty"`
+
+	// ChangedURLs are the public URLs of the files the change to the index created, rewrote, or removed, which may need purging from caches.
+	ChangedURLs []string `json:",omitempty"`
+}
+
+// changedURLs are the URLs set by SetChangedURLs, for the command's result.
+var changedURLs []string
+
+// SetChangedURLs records the public URLs of the files the command's change to the index affected, so they are included in its result.
+func SetChangedURLs(urls []string) {
+	changedURLs = urls
+}
+
+// NewChange returns the Change result for the given repository, including what has been printed about the dry run, if this is one, and the URLs the change affected.
+func NewChange(repoDir string) Change {
+	return Change{Repository: repoDir, DryRun: DryRun, Plan: plan, ChangedURLs: changedURLs}
+}
+
+// PrintText prints nothing, since commands that change a repository don't print anything when they succeed.
+func (result Change) PrintText(w io.Writer) {}
+
+// FinishChange prints the Change result for the given repository if the command that changed it succeeded, and returns the command's error.
+func FinishChange(repoDir string, err subcmd.Error) subcmd.Error {
+	if err == nil {
+		subcmd.PrintResult(NewChange(repoDir))
+	}
+	return err
+}
+
+// ChannelResult is the result of a command that changes a channel. It holds the channel's state after the change, or its current state in a dry run.
+type ChannelResult struct {
+	Change
+
+	Channel        string
+	Name           string `json:",omitempty"`
+	Description    string `json:",omitempty"`
+	CurrentVersion int
+
+	// Rollout is the staged rollout in progress on the channel, if there is one.
+	Rollout *Rollout `json:",omitempty"`
+
+	// Removed is true if the channel no longer exists.
+	Removed bool `json:",omitempty"`
+}
+
+// ChannelState returns the state of the given channel in the given repository as a ChannelResult.
+func ChannelState(repoDir, chanId string) (ChannelResult, subcmd.Error) {
+	result := ChannelResult{Change: NewChange(repoDir), Channel: chanId, CurrentVersion: -1}
+
+	indexData, err := LoadIndex(repoDir)
+	if err != nil {
+		return result, err
+	}
+
+	i := indexData.FindChannel(chanId)
+	if i < 0 {
+		// In a dry run, a channel that doesn't exist may just not have been created or renamed yet.
+		result.Removed = !DryRun
+		return result, nil
+	}
+	result.Name = indexData.Channels[i].Name
+	result.Description = indexData.ChannelInfo[chanId].Description
+	result.CurrentVersion = indexData.Channels[i].CurrentVersion
+	if r, ok := indexData.Rollouts[chanId]; ok {
+		result.Rollout = &r
+	}
+	return result, nil
+}
+
+// ChangeChannel calls fn with the repository locked, like WithLock, and then prints the state of the given channel as the command's result.
+func ChangeChannel(repoDir, chanId string, fn func() subcmd.Error) subcmd.Error {
+	if err := WithLock(repoDir, fn); err != nil {
+		return err
+	}
+
+	result, err := ChannelState(repoDir, chanId)
+	if err != nil {
+		return err
+	}
+	subcmd.PrintResult(result)
+	return nil
+}
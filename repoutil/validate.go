@@ -0,0 +1,147 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repoutil
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/MultiMC/repoman/subcmd"
+)
+
+// InvalidIndexExitCode is the exit code used when an index fails validation.
+const InvalidIndexExitCode = 50
+
+// ValidateIndex checks that writing the given index to the given repository wouldn't introduce problems that break clients. It makes sure that:
+//
+// + Version IDs are unique and listed in increasing order, so new versions have IDs above every existing one.
+// + Every version listed in the index has a version file in the repository directory.
+// + Every channel and rollout points at versions that are listed in the index.
+// + Extra channel and version information only refers to channels and versions that exist.
+//
+// Problems that the repository's current index already has are ignored, so that a broken repository can still be changed and repaired.
+// Problems are matched by what is wrong and which version or channel it is wrong with, and counted, so that another copy of a version ID that is already used twice is still reported.
+// If any new problems are found, an Error listing all of them is returned with the exit code InvalidIndexExitCode.
+func ValidateIndex(repoDir string, indexData Index) subcmd.Error {
+	// A missing or broken index has no problems worth keeping, so everything in the new one is checked.
+	oldIndex, _ := LoadIndex(repoDir)
+	existing := map[problemKey]int{}
+	for _, problem := range indexProblems(repoDir, oldIndex) {
+		existing[problem.problemKey]++
+	}
+
+	problems := []string{}
+	for _, problem := range indexProblems(repoDir, indexData) {
+		if existing[problem.problemKey] > 0 {
+			existing[problem.problemKey]--
+			continue
+		}
+		problems = append(problems, problem.msg)
+	}
+
+	if len(problems) > 0 {
+		return subcmd.MessageError(fmt.Sprintf("Invalid index: %s.", strings.Join(problems, "; ")), InvalidIndexExitCode)
+	}
+	return nil
+}
+
+// problemKey identifies a problem with an index: kind is what is wrong, and subject is the version or channel it is wrong with.
+// The key of a problem stays the same when unrelated parts of the index change, unlike its message.
+type problemKey struct {
+	kind    string
+	subject string
+}
+
+// indexProblem is a problem with an index, with a message describing it.
+type indexProblem struct {
+	problemKey
+	msg string
+}
+
+// indexProblems returns every problem ValidateIndex checks for in the given index.
+func indexProblems(repoDir string, indexData Index) []indexProblem {
+	problems := []indexProblem{}
+	add := func(kind, subject, format string, args ...interface{}) {
+		problems = append(problems, indexProblem{problemKey{kind, subject}, fmt.Sprintf(format, args...)})
+	}
+
+	versions := map[int]bool{}
+	lastId := -1
+	for _, version := range indexData.Versions {
+		switch {
+		case versions[version.Id]:
+			add("duplicate", versionSubject(version.Id), "version ID %d is used more than once", version.Id)
+		case version.Id <= lastId:
+			add("order", versionSubject(version.Id), "version ID %d comes after version ID %d", version.Id, lastId)
+		}
+		versions[version.Id] = true
+		if version.Id > lastId {
+			lastId = version.Id
+		}
+
+		if _, err := os.Stat(path.Join(repoDir, VersionFileName(version.Id))); err != nil {
+			add("file", versionSubject(version.Id), "version %d has no version file", version.Id)
+		}
+	}
+
+	channels := map[string]int{}
+	for _, channel := range indexData.Channels {
+		if _, dup := channels[channel.Id]; dup {
+			add("duplicate", channelSubject(channel.Id), "channel ID '%s' is used more than once", channel.Id)
+		}
+		channels[channel.Id] = channel.CurrentVersion
+
+		if !versions[channel.CurrentVersion] {
+			add("version", channelSubject(channel.Id), "channel '%s' points at version %d, which doesn't exist", channel.Id, channel.CurrentVersion)
+		}
+	}
+
+	for chanId, rollout := range indexData.Rollouts {
+		currentVersion, ok := channels[chanId]
+		switch {
+		case !ok:
+			add("rollout channel", channelSubject(chanId), "there is a rollout for channel '%s', which doesn't exist", chanId)
+		case rollout.PreviousVersion != currentVersion:
+			add("rollout start", channelSubject(chanId), "the rollout on channel '%s' started from version %d, but the channel points at version %d", chanId, rollout.PreviousVersion, currentVersion)
+		}
+		if !versions[rollout.NewVersion] {
+			add("rollout version", channelSubject(chanId), "the rollout on channel '%s' is for version %d, which doesn't exist", chanId, rollout.NewVersion)
+		}
+	}
+
+	for chanId := range indexData.ChannelInfo {
+		if _, ok := channels[chanId]; !ok {
+			add("info", channelSubject(chanId), "there is channel information for channel '%s', which doesn't exist", chanId)
+		}
+	}
+
+	for versionId := range indexData.VersionInfo {
+		if !versions[versionId] {
+			add("info", versionSubject(versionId), "there is version information for version %d, which doesn't exist", versionId)
+		}
+	}
+
+	return problems
+}
+
+func versionSubject(versionId int) string {
+	return fmt.Sprintf("version %d", versionId)
+}
+
+func channelSubject(chanId string) string {
+	return fmt.Sprintf("channel '%s'", chanId)
+}
@@ -0,0 +1,122 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package repoutil_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/MultiMC/repoman/repoutil"
+	"github.com/MultiMC/repoman/repoutil/repotest"
+)
+
+func TestValidateIndex(t *testing.T) {
+	withRollout := repotest.Index([]int{1, 2}, map[string]int{"stable": 1})
+	withRollout.Rollouts = map[string]repoutil.Rollout{"stable": {NewVersion: 2, PreviousVersion: 1, Percentage: 10}}
+	badRollout := repotest.Index([]int{1, 2}, map[string]int{"stable": 1})
+	badRollout.Rollouts = map[string]repoutil.Rollout{"stable": {NewVersion: 3, PreviousVersion: 2, Percentage: 10}}
+	orphanInfo := repotest.Index([]int{1}, nil)
+	orphanInfo.ChannelInfo = map[string]repoutil.ChannelInfo{"gone": {Description: "x"}}
+	orphanInfo.VersionInfo = map[int]repoutil.VersionSummaryMeta{7: {}}
+
+	tests := []struct {
+		desc     string
+		newIndex repoutil.Index
+		// problems are parts of the error message, or nil if the index is valid.
+		problems []string
+	}{
+		{"empty", repotest.Index(nil, nil), nil},
+		{"valid", repotest.Index([]int{1, 2}, map[string]int{"stable": 1, "beta": 2}), nil},
+		{"rollout", withRollout, nil},
+		{"duplicate version", repotest.Index([]int{1, 2, 2}, nil), []string{"version ID 2 is used more than once"}},
+		{"out of order", repotest.Index([]int{2, 1}, nil), []string{"version ID 1 comes after version ID 2"}},
+		{"no version file", repotest.Index([]int{1, 2, 3}, nil), []string{"version 3 has no version file"}},
+		{"missing channel version", repotest.Index([]int{1}, map[string]int{"stable": 5}), []string{"channel 'stable' points at version 5, which doesn't exist"}},
+		{"bad rollout", badRollout, []string{"started from version 2, but the channel points at version 1", "is for version 3, which doesn't exist"}},
+		{"orphaned info", orphanInfo, []string{"channel information for channel 'gone'", "version information for version 7"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.desc, func(t *testing.T) {
+			err := repoutil.ValidateIndex(repotest.Repo(t, nil, 1, 2), test.newIndex)
+			if test.problems == nil {
+				if err != nil {
+					t.Errorf("unexpected error: %s", err)
+				}
+				return
+			}
+
+			if err == nil {
+				t.Fatalf("index was accepted, want problems %q", test.problems)
+			}
+			if err.ExitCode() != repoutil.InvalidIndexExitCode {
+				t.Errorf("exit code %d, want %d", err.ExitCode(), repoutil.InvalidIndexExitCode)
+			}
+			for _, problem := range test.problems {
+				if !strings.Contains(err.Error(), problem) {
+					t.Errorf("error %q doesn't mention %q", err, problem)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateIndexIgnoresExistingProblems(t *testing.T) {
+	// The repository's index already has a channel pointing at a version that doesn't exist.
+	oldIndex := repotest.Index([]int{1, 2}, map[string]int{"broken": 9})
+
+	accepted := map[string]repoutil.Index{
+		"unrelated change":              repotest.Index([]int{1, 2}, map[string]int{"broken": 9, "stable": 1}),
+		"repair":                        repotest.Index([]int{1, 2}, map[string]int{"broken": 2}),
+		"new version above the maximum": repotest.Index([]int{1, 2, 3}, map[string]int{"broken": 9}),
+	}
+	for desc, newIndex := range accepted {
+		if err := repoutil.ValidateIndex(repotest.Repo(t, &oldIndex, 0, 1, 2, 3), newIndex); err != nil {
+			t.Errorf("%s was rejected: %s", desc, err)
+		}
+	}
+
+	rejected := map[string]repoutil.Index{
+		"channel 'beta' points at version 8":    repotest.Index([]int{1, 2}, map[string]int{"broken": 9, "beta": 8}),
+		"version ID 0 comes after version ID 2": repotest.Index([]int{1, 2, 0}, map[string]int{"broken": 9}),
+	}
+	for problem, newIndex := range rejected {
+		err := repoutil.ValidateIndex(repotest.Repo(t, &oldIndex, 0, 1, 2, 3), newIndex)
+		switch {
+		case err == nil || !strings.Contains(err.Error(), problem):
+			t.Errorf("got %v, want a problem mentioning %q", err, problem)
+		case strings.Contains(err.Error(), "'broken'"):
+			t.Errorf("the existing problem was reported: %s", err)
+		}
+	}
+}
+
+// A problem that renders the same as one the repository already has is still new if there are more of them.
+func TestValidateIndexReportsAnotherDuplicate(t *testing.T) {
+	oldIndex := repotest.Index([]int{1, 2, 2}, nil)
+	repoDir := repotest.Repo(t, &oldIndex, 1, 2, 3)
+
+	if err := repoutil.ValidateIndex(repoDir, repotest.Index([]int{1, 2, 2, 3}, nil)); err != nil {
+		t.Errorf("adding a version to an index with a duplicate failed: %s", err)
+	}
+
+	err := repoutil.ValidateIndex(repoDir, repotest.Index([]int{1, 2, 2, 2}, nil))
+	if err == nil {
+		t.Fatal("adding a third copy of version 2 was allowed")
+	}
+	if !strings.Contains(err.Error(), "version ID 2 is used more than once") {
+		t.Errorf("error %q doesn't mention the duplicate", err)
+	}
+}
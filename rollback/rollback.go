@@ -0,0 +1,104 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+rollback contains the Command struct for repoman's "rollback" subcommand.
+*/
+
+package rollback
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/MultiMC/repoman/publish"
+	"github.com/MultiMC/repoman/repoutil"
+	"github.com/MultiMC/repoman/setchan"
+	"github.com/MultiMC/repoman/subcmd"
+)
+
+type Command struct{}
+
+func (cmd Command) Summary() string {
+	return "Points a channel back at the version it pointed at before its last change."
+}
+func (cmd Command) Description() string {
+	return "Looks up the most recent change to the given channel in the repository's channel history and points the channel back at the version it pointed at before that change. The rollback is itself recorded in the history, and skipped along with the change it undid by later rollbacks, so rolling back again goes further back."
+}
+func (cmd Command) Usage() string { return "REPO_DIR CHANNEL_ID [REASON]" }
+func (cmd Command) ArgHelp() string {
+	return "REPO_DIR - The repository directory containing the channel.\nCHANNEL_ID - The ID of the channel to roll back.\nREASON - Optional explanation of the rollback to record in the channel's history."
+}
+func (cmd Command) SetFlags(flags *flag.FlagSet) {
+	repoutil.AddDryRunFlag(flags)
+	publish.AddPurgeListFlag(flags)
+}
+
+func (cmd Command) Execute(args ...string) subcmd.Error {
+	if len(args) < 2 {
+		return subcmd.UsageError("'rollback' command requires at least two arguments.")
+	} else {
+		reason := ""
+		if len(args) >= 3 {
+			reason = args[2]
+		}
+		return repoutil.ChangeChannel(args[0], args[1], func() subcmd.Error {
+			return Rollback(args[0], args[1], reason)
+		})
+	}
+}
+
+// Rollback points the given channel back at the version it pointed at before its most recent change.
+func Rollback(repoDir, chanId, reason string) subcmd.Error {
+	errFmt := fmt.Sprintf("Can't roll back channel '%s' in repository '%s': %%s", chanId, repoDir)
+
+	indexData, err := repoutil.LoadIndex(repoDir)
+	if err != nil {
+		return subcmd.WrapError(errFmt, err)
+	}
+
+	i := indexData.FindChannel(chanId)
+	if i < 0 {
+		return subcmd.MessageError(fmt.Sprintf(errFmt, "No such channel."), 16)
+	}
+	currentVersion := indexData.Channels[i].CurrentVersion
+
+	history, err := repoutil.LoadHistory(repoDir)
+	if err != nil {
+		return subcmd.WrapError(errFmt, err)
+	}
+
+	// The last change has to be the one that put the channel where it is now. Otherwise the channel was changed without being recorded and we can't know where it was before.
+	last, ok := repoutil.LastChannelChange(history, chanId)
+	switch {
+	case !ok:
+		return subcmd.MessageError(fmt.Sprintf(errFmt, "The channel has no recorded history."), 47)
+	case last.NewVersion != currentVersion:
+		return subcmd.MessageError(fmt.Sprintf(errFmt, fmt.Sprintf("The channel's history doesn't match its current version (%d).", currentVersion)), 47)
+	}
+
+	// Earlier rollbacks and the changes they undid are skipped, so repeated rollbacks keep going back instead of undoing each other.
+	target, ok := repoutil.RollbackTarget(history, chanId)
+	switch {
+	case !ok:
+		return subcmd.MessageError(fmt.Sprintf(errFmt, "Every recorded change to the channel has already been rolled back."), 47)
+	case target.OldVersion < 0:
+		return subcmd.MessageError(fmt.Sprintf(errFmt, "The channel didn't exist before the change being rolled back."), 47)
+	}
+
+	if reason == "" {
+		reason = fmt.Sprintf("Rolled back from version %d.", currentVersion)
+	}
+	return setchan.RollBackChan(repoDir, chanId, target.OldVersion, reason)
+}
@@ -0,0 +1,47 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollback
+
+import (
+	"testing"
+
+	"github.com/MultiMC/repoman/repoutil"
+	"github.com/MultiMC/repoman/repoutil/repotest"
+)
+
+// Each rollback goes one change further back, until the change that created the channel is reached.
+func TestRepeatedRollbacks(t *testing.T) {
+	indexData := repotest.Index([]int{1, 2, 3}, map[string]int{"stable": 3})
+	repoDir := repotest.Repo(t, &indexData, 1, 2, 3)
+	for _, change := range []repoutil.ChannelChange{{Channel: "stable", OldVersion: -1, NewVersion: 1}, {Channel: "stable", OldVersion: 1, NewVersion: 2}, {Channel: "stable", OldVersion: 2, NewVersion: 3}} {
+		if err := repoutil.RecordChannelChange(repoDir, change); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, want := range []int{2, 1} {
+		if err := Rollback(repoDir, "stable", ""); err != nil {
+			t.Fatalf("rolling back to version %d failed: %s", want, err)
+		}
+		rolledBack, _ := repoutil.LoadIndex(repoDir)
+		if got := rolledBack.Channels[0].CurrentVersion; got != want {
+			t.Fatalf("channel points at version %d after rolling back, want %d", got, want)
+		}
+	}
+
+	if err := Rollback(repoDir, "stable", ""); err == nil || err.ExitCode() != 47 {
+		t.Errorf("rolling back past the channel's creation returned %v, want exit code 47", err)
+	}
+}
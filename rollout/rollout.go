@@ -0,0 +1,265 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+rollout contains the Command struct for repoman's "rollout" subcommand, which manages staged rollouts of new versions to a channel.
+*/
+
+package rollout
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/MultiMC/repoman/publish"
+	"github.com/MultiMC/repoman/repoutil"
+	"github.com/MultiMC/repoman/subcmd"
+)
+
+type Command struct{}
+
+func (cmd Command) Summary() string {
+	return "Manages staged rollouts of new versions to a percentage of a channel's clients."
+}
+func (cmd Command) Description() string {
+	return "Starts, advances, pauses, resumes, or aborts a staged rollout on the given channel, or shows its status. While a rollout is in progress, the channel's current version stays at the previous version for clients that don't support rollouts. Advancing a rollout to 100 percent completes it and points the channel at the new version."
+}
+func (cmd Command) Usage() string {
+	return "REPO_DIR CHANNEL_ID status|start VERSION_ID PERCENT|advance PERCENT|pause|resume|abort"
+}
+func (cmd Command) ArgHelp() string {
+	return "REPO_DIR - The repository directory containing the channel.\nCHANNEL_ID - The ID of the channel to manage the rollout of.\nstatus - Shows the rollout in progress on the channel, if there is one.\nstart VERSION_ID PERCENT - Starts rolling out the given version to the given percentage of the channel's clients.\nadvance PERCENT - Increases the percentage of clients that get the new version. 100 completes the rollout.\npause - Stops the rollout from being advanced until it is resumed.\nresume - Allows a paused rollout to be advanced again.\nabort - Cancels the rollout. All clients stay on the channel's current version."
+}
+func (cmd Command) SetFlags(flags *flag.FlagSet) {
+	repoutil.AddDryRunFlag(flags)
+	publish.AddPurgeListFlag(flags)
+}
+
+func (cmd Command) Execute(args ...string) subcmd.Error {
+	if len(args) < 3 {
+		return subcmd.UsageError("'rollout' command requires at least three arguments.")
+	}
+
+	repoDir := args[0]
+	chanId := args[1]
+	action := args[2]
+
+	if action == "status" {
+		status, err := GetStatus(repoDir, chanId)
+		if err != nil {
+			return err
+		}
+		subcmd.PrintResult(status)
+		return nil
+	}
+
+	var run func() subcmd.Error
+	switch action {
+	case "start":
+		if len(args) < 5 {
+			return subcmd.UsageError("'rollout start' requires a version ID and a percentage.")
+		}
+		versionId, err := strconv.ParseInt(args[3], 10, 0)
+		if err != nil || versionId < 0 {
+			return subcmd.UsageError("Version ID must be a positive integer.")
+		}
+		percent, percentErr := parsePercent(args[4])
+		if percentErr != nil {
+			return percentErr
+		}
+		run = func() subcmd.Error { return Start(repoDir, chanId, int(versionId), percent) }
+	case "advance":
+		if len(args) < 4 {
+			return subcmd.UsageError("'rollout advance' requires a percentage.")
+		}
+		percent, percentErr := parsePercent(args[3])
+		if percentErr != nil {
+			return percentErr
+		}
+		run = func() subcmd.Error { return Advance(repoDir, chanId, percent) }
+	case "pause":
+		run = func() subcmd.Error { return SetPaused(repoDir, chanId, true) }
+	case "resume":
+		run = func() subcmd.Error { return SetPaused(repoDir, chanId, false) }
+	case "abort":
+		run = func() subcmd.Error { return Abort(repoDir, chanId) }
+	default:
+		return subcmd.UsageError(fmt.Sprintf("Unknown rollout action '%s'.", action))
+	}
+
+	return repoutil.ChangeChannel(repoDir, chanId, run)
+}
+
+func parsePercent(percentStr string) (int, subcmd.Error) {
+	percent, err := strconv.ParseInt(percentStr, 10, 0)
+	if err != nil || percent < 1 || percent > 100 {
+		return 0, subcmd.UsageError("Percentage must be an integer from 1 to 100.")
+	}
+	return int(percent), nil
+}
+
+// Status is the rollout status of a channel.
+type Status struct {
+	Channel        string
+	CurrentVersion int
+
+	// Rollout is the rollout in progress on the channel, if there is one.
+	Rollout *repoutil.Rollout `json:",omitempty"`
+}
+
+// GetStatus returns the rollout status of the given channel.
+func GetStatus(repoDir, chanId string) (status Status, err subcmd.Error) {
+	errFmt := fmt.Sprintf("Can't show rollout status of channel '%s' in repository '%s': %%s", chanId, repoDir)
+
+	indexData, err := repoutil.LoadIndex(repoDir)
+	if err != nil {
+		return status, subcmd.WrapError(errFmt, err)
+	}
+
+	i := indexData.FindChannel(chanId)
+	if i < 0 {
+		return status, subcmd.MessageError(fmt.Sprintf(errFmt, "No such channel."), 16)
+	}
+
+	status = Status{Channel: chanId, CurrentVersion: indexData.Channels[i].CurrentVersion}
+	if r, ok := indexData.Rollouts[chanId]; ok {
+		status.Rollout = &r
+	}
+	return status, nil
+}
+
+// PrintText prints a sentence describing the rollout in progress on the channel.
+func (status Status) PrintText(w io.Writer) {
+	if r := status.Rollout; r != nil {
+		state := "in progress"
+		if r.Paused {
+			state = "paused"
+		}
+		fmt.Fprintf(w, "Channel %s is rolling out version %d to %d%% of clients (%s). Other clients use version %d.\n", status.Channel, r.NewVersion, r.Percentage, state, r.PreviousVersion)
+	} else {
+		fmt.Fprintf(w, "Channel %s has no rollout in progress. All clients use version %d.\n", status.Channel, status.CurrentVersion)
+	}
+}
+
+// Start starts rolling out the given version to the given percentage of the given channel's clients.
+func Start(repoDir, chanId string, versionId, percent int) subcmd.Error {
+	errFmt := fmt.Sprintf("Can't start rolling out version %d on channel '%s' in repository '%s': %%s", versionId, chanId, repoDir)
+
+	indexData, err := repoutil.LoadIndex(repoDir)
+	if err != nil {
+		return subcmd.WrapError(errFmt, err)
+	}
+
+	i := indexData.FindChannel(chanId)
+	if i < 0 {
+		return subcmd.MessageError(fmt.Sprintf(errFmt, "No such channel."), 16)
+	}
+	if _, ok := indexData.Rollouts[chanId]; ok {
+		return subcmd.MessageError(fmt.Sprintf(errFmt, "The channel already has a rollout in progress. Abort or complete it first."), 49)
+	}
+	if indexData.Channels[i].CurrentVersion == versionId {
+		return subcmd.MessageError(fmt.Sprintf(errFmt, "The channel already points at that version."), 49)
+	}
+
+	indexData.Rollouts[chanId] = repoutil.Rollout{NewVersion: versionId, PreviousVersion: indexData.Channels[i].CurrentVersion, Percentage: percent}
+	return finish(repoDir, chanId, indexData, errFmt)
+}
+
+// Advance increases the percentage of the given channel's clients that get the new version of its rollout. Advancing to 100 percent completes the rollout.
+func Advance(repoDir, chanId string, percent int) subcmd.Error {
+	errFmt := fmt.Sprintf("Can't advance the rollout on channel '%s' in repository '%s' to %d%%%%: %%s", chanId, repoDir, percent)
+
+	indexData, err := repoutil.LoadIndex(repoDir)
+	if err != nil {
+		return subcmd.WrapError(errFmt, err)
+	}
+
+	r, ok := indexData.Rollouts[chanId]
+	switch {
+	case !ok:
+		return subcmd.MessageError(fmt.Sprintf(errFmt, "The channel has no rollout in progress."), 49)
+	case r.Paused:
+		return subcmd.MessageError(fmt.Sprintf(errFmt, "The rollout is paused. Resume it first."), 49)
+	case percent <= r.Percentage:
+		return subcmd.MessageError(fmt.Sprintf(errFmt, fmt.Sprintf("The rollout is already at %d%%.", r.Percentage)), 49)
+	}
+
+	r.Percentage = percent
+	indexData.Rollouts[chanId] = r
+	return finish(repoDir, chanId, indexData, errFmt)
+}
+
+// SetPaused pauses or resumes the rollout on the given channel.
+func SetPaused(repoDir, chanId string, paused bool) subcmd.Error {
+	errFmt := fmt.Sprintf("Can't pause the rollout on channel '%s' in repository '%s': %%s", chanId, repoDir)
+	if !paused {
+		errFmt = fmt.Sprintf("Can't resume the rollout on channel '%s' in repository '%s': %%s", chanId, repoDir)
+	}
+
+	indexData, err := repoutil.LoadIndex(repoDir)
+	if err != nil {
+		return subcmd.WrapError(errFmt, err)
+	}
+
+	r, ok := indexData.Rollouts[chanId]
+	if !ok {
+		return subcmd.MessageError(fmt.Sprintf(errFmt, "The channel has no rollout in progress."), 49)
+	}
+
+	r.Paused = paused
+	indexData.Rollouts[chanId] = r
+	return finish(repoDir, chanId, indexData, errFmt)
+}
+
+// Abort cancels the rollout on the given channel. All of the channel's clients go back to its previous version.
+func Abort(repoDir, chanId string) subcmd.Error {
+	errFmt := fmt.Sprintf("Can't abort the rollout on channel '%s' in repository '%s': %%s", chanId, repoDir)
+
+	indexData, err := repoutil.LoadIndex(repoDir)
+	if err != nil {
+		return subcmd.WrapError(errFmt, err)
+	}
+
+	if _, ok := indexData.Rollouts[chanId]; !ok {
+		return subcmd.MessageError(fmt.Sprintf(errFmt, "The channel has no rollout in progress."), 49)
+	}
+
+	delete(indexData.Rollouts, chanId)
+	return finish(repoDir, chanId, indexData, errFmt)
+}
+
+// finish writes the given index after a rollout change. If the channel's rollout has reached 100 percent, it is completed first by pointing the channel at the new version and recording that in the channel history.
+func finish(repoDir, chanId string, indexData repoutil.Index, errFmt string) subcmd.Error {
+	r, ok := indexData.Rollouts[chanId]
+	completed := ok && r.Percentage >= 100
+	if completed {
+		indexData.Channels[indexData.FindChannel(chanId)].CurrentVersion = r.NewVersion
+		delete(indexData.Rollouts, chanId)
+	}
+
+	if err := publish.WriteIndex(repoDir, indexData); err != nil {
+		return subcmd.WrapError(errFmt, err)
+	}
+
+	if completed {
+		change := repoutil.ChannelChange{Channel: chanId, OldVersion: r.PreviousVersion, NewVersion: r.NewVersion, Reason: "Staged rollout completed."}
+		if err := repoutil.RecordChannelChange(repoDir, change); err != nil {
+			return subcmd.WrapError(errFmt, err)
+		}
+	}
+	// The browse pages show rollouts in progress, so they need refreshing even if the channel didn't change.
+	return publish.Refresh(repoDir, "")
+}
@@ -0,0 +1,93 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rollout
+
+import (
+	"testing"
+
+	"github.com/MultiMC/repoman/repoutil"
+	"github.com/MultiMC/repoman/repoutil/repotest"
+)
+
+// newRepo returns a repository with versions 1 and 2 and a stable channel pointing at version 1.
+func newRepo(t *testing.T) string {
+	indexData := repotest.Index([]int{1, 2}, map[string]int{"stable": 1})
+	return repotest.Repo(t, &indexData, 1, 2)
+}
+
+// loadStable returns the stable channel's current version and its rollout, if it has one.
+func loadStable(t *testing.T, repoDir string) (currentVersion int, rollout *repoutil.Rollout) {
+	indexData, err := repoutil.LoadIndex(repoDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, ok := indexData.Rollouts["stable"]; ok {
+		rollout = &r
+	}
+	return indexData.Channels[indexData.FindChannel("stable")].CurrentVersion, rollout
+}
+
+func TestAdvanceTo100Completes(t *testing.T) {
+	repoDir := newRepo(t)
+
+	if err := Start(repoDir, "stable", 2, 10); err != nil {
+		t.Fatal(err)
+	}
+	if err := Advance(repoDir, "stable", 50); err != nil {
+		t.Fatal(err)
+	}
+	if current, r := loadStable(t, repoDir); current != 1 || r == nil || r.Percentage != 50 {
+		t.Fatalf("after advancing to 50%%, channel is at version %d with rollout %+v", current, r)
+	}
+
+	if err := Advance(repoDir, "stable", 100); err != nil {
+		t.Fatal(err)
+	}
+	if current, r := loadStable(t, repoDir); current != 2 || r != nil {
+		t.Errorf("after advancing to 100%%, channel is at version %d with rollout %+v; want version 2 and no rollout", current, r)
+	}
+
+	history, err := repoutil.LoadHistory(repoDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last, ok := repoutil.LastChannelChange(history, "stable")
+	if !ok || last.OldVersion != 1 || last.NewVersion != 2 || last.Reason != "Staged rollout completed." {
+		t.Errorf("last recorded change is %+v, want the completed rollout from version 1 to 2", last)
+	}
+}
+
+func TestAbortRestoresPreviousVersion(t *testing.T) {
+	repoDir := newRepo(t)
+
+	if err := Start(repoDir, "stable", 2, 30); err != nil {
+		t.Fatal(err)
+	}
+	if err := Abort(repoDir, "stable"); err != nil {
+		t.Fatal(err)
+	}
+	if current, r := loadStable(t, repoDir); current != 1 || r != nil {
+		t.Errorf("after aborting, channel is at version %d with rollout %+v; want the previous version 1 and no rollout", current, r)
+	}
+
+	// Nothing was completed, so nothing is recorded in the history.
+	if history, _ := repoutil.LoadHistory(repoDir); len(history) != 0 {
+		t.Errorf("aborting recorded %+v in the history", history)
+	}
+
+	if err := Abort(repoDir, "stable"); err == nil || err.ExitCode() != 49 {
+		t.Errorf("aborting again returned %v, want exit code 49", err)
+	}
+}
@@ -0,0 +1,289 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+serve contains the Command struct for repoman's "serve" subcommand, which serves a repository and its file storage over HTTP for testing.
+*/
+
+package serve
+
+import (
+	"crypto/md5"
+	"flag"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/MultiMC/repoman/browse"
+	"github.com/MultiMC/repoman/config"
+	"github.com/MultiMC/repoman/feed"
+	"github.com/MultiMC/repoman/logging"
+	"github.com/MultiMC/repoman/repoutil"
+	"github.com/MultiMC/repoman/subcmd"
+
+	"github.com/MultiMC/GoUpdate/repo"
+)
+
+var log = logging.New("serve")
+
+type Command struct {
+	addr      string
+	repoPath  string
+	filesPath string
+}
+
+func (cmd Command) Summary() string {
+	return "Serves a repository and its file storage over HTTP."
+}
+func (cmd Command) Description() string {
+	return "Starts an HTTP server that serves the given repository directory and file storage directory, so GoUpdate clients can be tested without setting up a real web server. Range requests are supported, files in storage get ETags based on their MD5 sums, and every request is logged to standard error."
+}
+func (cmd Command) Usage() string { return "REPO_DIR [FILE_STORAGE]" }
+func (cmd Command) ArgHelp() string {
+	return "REPO_DIR - The repository directory to serve.\nFILE_STORAGE - The file storage directory to serve. Defaults to the configured one."
+}
+
+func (cmd *Command) SetFlags(flags *flag.FlagSet) {
+	flags.StringVar(&cmd.addr, "address", ":8080", "The `ADDRESS` to listen on.")
+	flags.StringVar(&cmd.repoPath, "repo-path", "/repo/", "The URL `PATH` to serve the repository directory at.")
+	flags.StringVar(&cmd.filesPath, "files-path", "/files/", "The URL `PATH` to serve the file storage directory at. This should match the path of the URL base given to the update command.")
+}
+
+func (cmd Command) Execute(args ...string) subcmd.Error {
+	if len(args) < 1 {
+		return subcmd.UsageError("'serve' command requires at least one argument.")
+	} else {
+		filesArg := ""
+		if len(args) >= 2 {
+			filesArg = args[1]
+		}
+		filesDir, err := config.StorageDir(args[0], filesArg)
+		if err != nil {
+			return err
+		}
+		if err := config.Require(filesDir, "file storage directory"); err != nil {
+			return err
+		}
+
+		return Serve(args[0], filesDir, cmd.addr, cmd.repoPath, cmd.filesPath)
+	}
+}
+
+func init() {
+	// Go doesn't know about some of the file types a repository contains.
+	mime.AddExtensionType(".json", "application/json")
+	mime.AddExtensionType(".atom", "application/atom+xml")
+}
+
+// Serve serves the given repository directory and file storage directory at the given URL paths on the given address. It only returns if the server fails.
+func Serve(repoDir, filesDir, addr, repoPath, filesPath string) subcmd.Error {
+	if err := repoutil.CheckRepoDir(repoDir); err != nil {
+		return subcmd.WrapError(fmt.Sprintf("Can't serve repository '%s': %%s", repoDir), err)
+	}
+
+	log.Notice("Serving repository", "repo", repoDir, "repoPath", slashed(repoPath), "storage", filesDir, "filesPath", slashed(filesPath), "address", addr)
+	if err := http.ListenAndServe(addr, logRequests(newHandler(repoDir, filesDir, repoPath, filesPath))); err != nil {
+		log.Error("HTTP server failed", "address", addr, "error", err)
+		return subcmd.CausedError(fmt.Sprintf("HTTP server on %s failed.", addr), 70, err)
+	}
+	return nil
+}
+
+// newHandler returns a handler that serves the given repository directory and file storage directory at the given URL paths.
+func newHandler(repoDir, filesDir, repoPath, filesPath string) http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle(slashed(repoPath), http.StripPrefix(slashed(repoPath), &fileHandler{root: repoDir, allowed: published}))
+	mux.Handle(slashed(filesPath), http.StripPrefix(slashed(filesPath), &fileHandler{root: filesDir, etags: &storageETags{repoDir: repoDir}}))
+	return mux
+}
+
+// slashed makes sure the given URL path starts and ends with a slash.
+func slashed(urlPath string) string {
+	if !strings.HasPrefix(urlPath, "/") {
+		urlPath = "/" + urlPath
+	}
+	if !strings.HasSuffix(urlPath, "/") {
+		urlPath += "/"
+	}
+	return urlPath
+}
+
+// published returns true if the file at the given cleaned URL path in a repository directory is one that clients or people browsing the repository read: the index, the version files, the feeds, and the browse pages.
+// Everything else in the repository directory, such as the configuration, the channel history, and the audit log, is RepoMan's own.
+func published(relPath string) bool {
+	if relPath == "/"+repo.IndexFileName {
+		return true
+	}
+	for _, dirName := range []string{feed.FeedDirName, browse.BrowseDirName} {
+		if relPath == "/"+dirName || strings.HasPrefix(relPath, "/"+dirName+"/") {
+			return true
+		}
+	}
+	if name := strings.TrimPrefix(relPath, "/"); !strings.Contains(name, "/") && strings.HasSuffix(name, ".json") {
+		versionId, err := strconv.Atoi(strings.TrimSuffix(name, ".json"))
+		return err == nil && repoutil.VersionFileName(versionId) == name
+	}
+	return false
+}
+
+// fileHandler serves the files in a directory. If etags is nil, ETags are calculated from the files' contents.
+// If allowed isn't nil, only the paths it returns true for are served. Dotfiles are never served.
+type fileHandler struct {
+	root    string
+	etags   *storageETags
+	allowed func(relPath string) bool
+}
+
+func (h *fileHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Cleaning the path as if it were absolute removes any ".." elements, so requests can't escape the root.
+	relPath := path.Clean("/" + r.URL.Path)
+	if strings.Contains(relPath, "/.") || (h.allowed != nil && !h.allowed(relPath)) {
+		http.NotFound(w, r)
+		return
+	}
+	filePath := filepath.Join(h.root, filepath.FromSlash(relPath))
+
+	info, err := os.Stat(filePath)
+	if err == nil && info.IsDir() {
+		filePath = filepath.Join(filePath, "index.html")
+		info, err = os.Stat(filePath)
+	}
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		http.Error(w, "Can't read file", http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	etag := ""
+	if h.etags != nil {
+		etag = h.etags.lookup(path.Base(relPath))
+	}
+	if etag == "" {
+		digest := md5.New()
+		io.Copy(digest, file)
+		file.Seek(0, io.SeekStart)
+		etag = fmt.Sprintf("%x", digest.Sum(nil))
+	}
+	// ServeContent handles If-None-Match and If-Range using this header.
+	w.Header().Set("ETag", `"`+etag+`"`)
+
+	http.ServeContent(w, r, info.Name(), info.ModTime(), file)
+}
+
+// storageETags maps the names of files in file storage to their MD5 sums, as recorded in the repository's version files.
+type storageETags struct {
+	repoDir string
+
+	lock   sync.Mutex
+	md5s   map[string]string
+	loaded time.Time
+}
+
+// lookup returns the MD5 sum of the file with the given name in storage, or an empty string if no version refers to it.
+// The version files are reloaded when a file isn't found, since a new version may have been added since they were last loaded.
+func (e *storageETags) lookup(name string) string {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	if sum, ok := e.md5s[name]; ok {
+		return sum
+	}
+
+	// Don't reload more than once a second, or requests for files that really aren't in any version would reload them every time.
+	if time.Since(e.loaded) < time.Second {
+		return ""
+	}
+	e.reload()
+	return e.md5s[name]
+}
+
+func (e *storageETags) reload() {
+	e.md5s = map[string]string{}
+	e.loaded = time.Now()
+
+	indexData, err := repoutil.LoadIndex(e.repoDir)
+	if err != nil {
+		return
+	}
+	for _, summary := range indexData.Versions {
+		version, err := repoutil.LoadVersion(e.repoDir, summary.Id)
+		if err != nil {
+			continue
+		}
+		for _, file := range version.Files {
+			for _, source := range file.Sources {
+				if storagePath := repoutil.StoragePath("", source); storagePath != "" {
+					e.md5s[storagePath] = file.MD5
+				}
+			}
+		}
+	}
+}
+
+// statusRecorder remembers the status code and number of bytes written to a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(data []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(data)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// logRequests wraps the given handler so every request is written to the log.
+func logRequests(handler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w}
+		handler.ServeHTTP(recorder, r)
+		if recorder.status == 0 {
+			recorder.status = http.StatusOK
+		}
+		fields := []interface{}{"remote", r.RemoteAddr, "method", r.Method, "uri", r.URL.RequestURI(), "status", recorder.status, "bytes", recorder.bytes, "duration", time.Since(start)}
+		if rangeHeader := r.Header.Get("Range"); rangeHeader != "" {
+			fields = append(fields, "range", rangeHeader)
+		}
+		log.Notice("Request", fields...)
+	})
+}
@@ -0,0 +1,79 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package serve
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/MultiMC/repoman/browse"
+	"github.com/MultiMC/repoman/config"
+	"github.com/MultiMC/repoman/feed"
+	"github.com/MultiMC/repoman/repoutil"
+	"github.com/MultiMC/repoman/repoutil/repotest"
+)
+
+func TestServedFiles(t *testing.T) {
+	indexData := repotest.Index([]int{1}, map[string]int{"stable": 1})
+	repoDir := repotest.Repo(t, &indexData, 1)
+	filesDir := t.TempDir()
+
+	files := map[string]string{
+		filepath.Join(repoDir, config.FileName):                    "{}",
+		filepath.Join(repoDir, repoutil.LockFileName):              "",
+		filepath.Join(repoDir, repoutil.AuditFileName):             "",
+		filepath.Join(repoDir, repoutil.HistoryFileName):           "[]",
+		filepath.Join(repoDir, ".hidden"):                          "",
+		filepath.Join(repoDir, feed.FeedDirName, "stable.atom"):    "<feed/>",
+		filepath.Join(repoDir, browse.BrowseDirName, "index.html"): "<html/>",
+		filepath.Join(filesDir, "abc123"):                          "contents",
+		filepath.Join(filesDir, ".git", "config"):                  "",
+	}
+	for name, contents := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(name, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	handler := newHandler(repoDir, filesDir, "/repo/", "/files/")
+	statuses := map[string]int{
+		"/repo/index.json":                           http.StatusOK,
+		"/repo/" + repoutil.VersionFileName(1):       http.StatusOK,
+		"/repo/" + feed.FeedDirName + "/stable.atom": http.StatusOK,
+		"/repo/" + browse.BrowseDirName + "/":        http.StatusOK,
+		"/files/abc123":                              http.StatusOK,
+		"/repo/" + config.FileName:                   http.StatusNotFound,
+		"/repo/" + repoutil.LockFileName:             http.StatusNotFound,
+		"/repo/" + repoutil.AuditFileName:            http.StatusNotFound,
+		"/repo/" + repoutil.HistoryFileName:          http.StatusNotFound,
+		"/repo/.hidden":                              http.StatusNotFound,
+		"/files/.git/config":                         http.StatusNotFound,
+		"/files/nonexistent":                         http.StatusNotFound,
+	}
+	for urlPath, want := range statuses {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest("GET", urlPath, nil))
+		if recorder.Code != want {
+			t.Errorf("GET %s got status %d, want %d", urlPath, recorder.Code, want)
+		}
+	}
+}
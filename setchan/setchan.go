@@ -15,153 +15,117 @@
 package setchan
 
 import (
-	"encoding/json"
+	"flag"
 	"fmt"
 	"github.com/MultiMC/GoUpdate/repo"
+	"github.com/MultiMC/repoman/logging"
+	"github.com/MultiMC/repoman/publish"
+	"github.com/MultiMC/repoman/repoutil"
 	"github.com/MultiMC/repoman/subcmd"
-	"io/ioutil"
-	"os"
-	"path"
 	"strconv"
 )
 
+var log = logging.New("setchan")
+
 type Command struct{}
 
 func (cmd Command) Summary() string {
-	return "Sets the current version of a repository's channel. Can also be used to remove the channel if the version isn't specified."
+	return "Sets the current version of a repository's channel."
 }
 func (cmd Command) Description() string {
-	return "Sets the current version of the given channel in the given repository to the given version ID. If no version ID is specified, the given channel will be deleted."
+	return "Sets the current version of the given channel in the given repository to the given version ID. If the channel doesn't exist, it will be created. Any staged rollout in progress on the channel is cancelled. Use the 'rmchan' command to remove a channel."
 }
 func (cmd Command) Usage() string {
-	return "REPO_DIR CHANNEL_ID [VERSION_ID]"
+	return "REPO_DIR CHANNEL_ID VERSION_ID [REASON]"
 }
 func (cmd Command) ArgHelp() string {
-	return "REPO_DIR - The repository directory to create the channel in.\nCHANNEL_ID - Unique string ID of the channel to create.\nVERSION_ID - Optional version ID. If specified, the given channel's current version will be set to this version ID. If not specified, the given channel will be removed."
+	return "REPO_DIR - The repository directory containing the channel.\nCHANNEL_ID - Unique string ID of the channel to set.\nVERSION_ID - The version ID to set the given channel's current version to.\nREASON - Optional explanation of the change to record in the channel's history."
+}
+func (cmd Command) SetFlags(flags *flag.FlagSet) {
+	repoutil.AddDryRunFlag(flags)
+	publish.AddPurgeListFlag(flags)
 }
 
 func (cmd Command) Execute(args ...string) subcmd.Error {
-	if len(args) < 2 {
-		return subcmd.UsageError("'setchan' command takes at least two arguments.")
+	if len(args) < 3 {
+		return subcmd.UsageError("'setchan' command takes at least three arguments.")
 	} else {
 		repoDir := args[0]
 		chanId := args[1]
-		versionIdStr := "-1"
+		versionIdStr := args[2]
+		reason := ""
 
-		if len(args) >= 3 {
-			versionIdStr = args[2]
+		if len(args) >= 4 {
+			reason = args[3]
 		}
 
 		versionId, err := strconv.ParseInt(versionIdStr, 10, 0)
 
-		if err != nil {
+		if err != nil || versionId < 0 {
 			return subcmd.UsageError("Version ID must be a positive integer.")
 		} else {
-			return SetChan(repoDir, chanId, int(versionId))
+			return repoutil.ChangeChannel(repoDir, chanId, func() subcmd.Error {
+				return SetChan(repoDir, chanId, int(versionId), reason)
+			})
 		}
 	}
 }
 
-func SetChan(repoDir, chanId string, versionId int) subcmd.Error {
-	var errFmt string
-	if versionId >= 0 {
-		errFmt = fmt.Sprintf("Can't set channel '%s' to version '%d' for repository '%s': %%s", chanId, versionId, repoDir)
-	} else {
-		errFmt = fmt.Sprintf("Can't remove channel '%s' from repository '%s': %%s", chanId, repoDir)
-	}
+// SetChan points the given channel at the given version and records the change in the repository's channel history along with the given reason.
+func SetChan(repoDir, chanId string, versionId int, reason string) subcmd.Error {
+	return setChan(repoDir, chanId, versionId, reason, false)
+}
 
-	// Make sure the repository directory exists.
-	if info, err := os.Stat(repoDir); err != nil {
-		var code int
-		var msg string
-		switch {
-		case os.IsNotExist(err):
-			msg = "Invalid repository: repository directory doesn't exist."
-			code = 10
-		case os.IsPermission(err):
-			msg = "Can't access repository directory: permission denied."
-			code = 20
-		default:
-			msg = "Can't access repository directory: an unknown error occurred."
-			code = -2
-		}
-		return subcmd.CausedError(fmt.Sprintf(errFmt, msg), code, err)
-	} else if !info.IsDir() {
-		return subcmd.MessageError(fmt.Sprintf(errFmt, "The path %s is not a valid repository. Must be a directory.", repoDir), 10)
+// RollBackChan is SetChan for rollbacks. The change is marked as a rollback in the channel history, so that later rollbacks skip the change it undid.
+func RollBackChan(repoDir, chanId string, versionId int, reason string) subcmd.Error {
+	return setChan(repoDir, chanId, versionId, reason, true)
+}
+
+func setChan(repoDir, chanId string, versionId int, reason string, rollback bool) subcmd.Error {
+	errFmt := fmt.Sprintf("Can't set channel '%s' to version '%d' for repository '%s': %%s", chanId, versionId, repoDir)
+
+	indexData, err := repoutil.LoadIndex(repoDir)
+	if err != nil {
+		return subcmd.WrapError(errFmt, err)
 	}
 
-	indexFilePath := path.Join(repoDir, "index.json")
-
-	// Try to read the index file.
-	fileData, indexErr := ioutil.ReadFile(indexFilePath)
-	if indexErr != nil {
-		// Handle errors.
-		var code int
-		var msg string
-		switch {
-		case os.IsNotExist(indexErr):
-			msg = "Invalid repository (%s): index file is missing."
-			code = 13
-		case os.IsPermission(indexErr):
-			msg = "Can't access repository's index file: permission denied."
-			code = 23
-		default:
-			msg = "An unknown error occurred when trying to read the repository's index file."
-			code = -2
+	// Now, check if the channel exists and, if so, set its current version to the version ID given.
+	oldVersionId := -1
+	if i := indexData.FindChannel(chanId); i >= 0 {
+		oldVersionId = indexData.Channels[i].CurrentVersion
+		indexData.Channels[i].CurrentVersion = versionId
+	} else {
+		// If the channel doesn't already exist, add it.
+		if err := repoutil.CheckChannelId(chanId); err != nil {
+			return subcmd.WrapError(errFmt, err)
 		}
-		return subcmd.CausedError(fmt.Sprintf(errFmt, msg), code, indexErr)
+		log.Debug("Channel doesn't exist, creating it", "channel", chanId)
+		channel := repo.Channel{Id: chanId, Name: chanId, CurrentVersion: versionId}
+		indexData.Channels = append(indexData.Channels, channel)
 	}
 
-	// Unmarshal the JSON.
-	var indexData repo.Index
-	if err := json.Unmarshal(fileData, &indexData); err != nil {
-		return subcmd.CausedError(fmt.Sprintf(errFmt, err.Error()), 12, err)
+	// Setting the channel directly replaces any rollout that was in progress on it.
+	if r, ok := indexData.Rollouts[chanId]; ok {
+		log.Info("Cancelling rollout", "channel", chanId, "version", r.NewVersion, "percentage", r.Percentage)
+		delete(indexData.Rollouts, chanId)
 	}
 
-	// Now, check if the channel exists and, if so, set its current version to the version ID given (or remove it if version ID is < 0).
-	chanExists := false
-	for i, existingChan := range indexData.Channels {
-		if existingChan.Id == chanId {
-			if versionId < 0 {
-				// Removing from a slice is messy, but this works.
-				// Basically, it splits the slice into two parts, the first half being everything before the index to remove and the second half being everything after the index to remove.
-				// Then, just append those two together.
-				indexData.Channels = append(indexData.Channels[:i], indexData.Channels[i+1:]...)
-			} else {
-				existingChan.CurrentVersion = versionId
-				indexData.Channels[i] = existingChan
-			}
-			chanExists = true
-			break
-		}
+	// Finally, write the index back to the file.
+	if err := publish.WriteIndex(repoDir, indexData); err != nil {
+		return subcmd.WrapError(errFmt, err)
 	}
 
-	// If the channel doesn't already exist, add it.
-	if !chanExists {
-		// Create a new, blank channel data structure with the given version ID as its current version. We'll overwrite this with the existing one if it exists.
-		channel := repo.Channel{Id: chanId, Name: chanId, CurrentVersion: versionId}
-
-		// Add the channel to the list.
-		indexData.Channels = append(indexData.Channels, channel)
+	if !repoutil.DryRun {
+		log.Info("Set channel", "repo", repoDir, "channel", chanId, "from", oldVersionId, "to", versionId, "reason", reason)
 	}
 
-	// Finally, write the index back to the file.
-	if indexFile, err := os.OpenFile(indexFilePath, os.O_WRONLY | os.O_TRUNC, 0644); err != nil {
-		var code int
-		var msg string
-		switch {
-		case os.IsPermission(err):
-			msg = "Can't write index file: permission denied."
-			code = 45
-		default:
-			msg = "An unknown error occurred when trying to write the index file."
-			code = -2
+	// Remember where the channel used to point so the change can be rolled back.
+	if oldVersionId != versionId {
+		change := repoutil.ChannelChange{Channel: chanId, OldVersion: oldVersionId, NewVersion: versionId, Rollback: rollback, Reason: reason}
+		if err := repoutil.RecordChannelChange(repoDir, change); err != nil {
+			return subcmd.WrapError(errFmt, err)
 		}
-		return subcmd.CausedError(fmt.Sprintf(errFmt, msg), code, err)
-	} else {
-		jsonData, _ := json.Marshal(indexData)
-		indexFile.Write(jsonData)
 	}
 
-	return nil
+	return publish.Refresh(repoDir, "")
 }
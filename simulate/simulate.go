@@ -0,0 +1,239 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+/*
+simulate contains the Command struct for repoman's "simulate" subcommand.
+*/
+
+package simulate
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/MultiMC/repoman/config"
+	"github.com/MultiMC/repoman/diff"
+	"github.com/MultiMC/repoman/md5util"
+	"github.com/MultiMC/repoman/progress"
+	"github.com/MultiMC/repoman/repoutil"
+	"github.com/MultiMC/repoman/subcmd"
+
+	"github.com/MultiMC/GoUpdate/repo"
+)
+
+type Command struct {
+	installedId int
+}
+
+func (cmd Command) Summary() string {
+	return "Shows what a client would do to update to a given version."
+}
+func (cmd Command) Description() string {
+	return "Works out which files the GoUpdate client would download, delete, and change the permissions of in order to update an installation to the given version. The installation can either be a local directory or a version that's already in the repository."
+}
+func (cmd Command) Usage() string { return "REPO_DIR FILE_STORAGE SOURCE TARGET_ID" }
+func (cmd Command) ArgHelp() string {
+	return "REPO_DIR - The repository directory containing the target version.\nFILE_STORAGE - The repository's file storage directory. This is used to determine download sizes. Give \"-\" to use the configured one.\nSOURCE - Either the path to a local installation directory or the ID of the version the client is updating from. If a directory with this name exists, it is used.\nTARGET_ID - The ID of the version the client is updating to."
+}
+
+func (cmd *Command) SetFlags(flags *flag.FlagSet) {
+	flags.IntVar(&cmd.installedId, "installed", -1, "When SOURCE is a directory, the `ID` of the version it was installed from. Files from that version that aren't in the target version are reported as deletions; other files that aren't in the target version are always reported as untracked.")
+}
+
+func (cmd Command) Execute(args ...string) subcmd.Error {
+	if len(args) != 4 {
+		// The output format used to be an optional fifth argument, so it gets a hint.
+		return subcmd.UsageError("'simulate' command requires four arguments. Use the global --output option to choose the output format.")
+	} else {
+		repoDir := args[0]
+		filesDir, cfgErr := config.StorageDir(repoDir, args[1])
+		if cfgErr != nil {
+			return cfgErr
+		}
+		if err := config.Require(filesDir, "file storage directory"); err != nil {
+			return err
+		}
+		source := args[2]
+
+		targetId, err := strconv.ParseInt(args[3], 10, 0)
+		if err != nil {
+			return subcmd.UsageError("Target version ID must be a positive integer.")
+		}
+
+		result, simErr := Simulate(repoDir, filesDir, source, int(targetId), cmd.installedId)
+		if simErr != nil {
+			return simErr
+		}
+
+		subcmd.PrintResult(result)
+		return nil
+	}
+}
+
+// Operation is a single file operation that the client would perform.
+type Operation struct {
+	// Type is either "download", "delete", "chmod", or "untracked". Untracked files are files in a local installation that the client leaves alone, since they aren't part of the version it was installed from.
+	Type string
+	Path string
+
+	// Size is the number of bytes downloaded for download operations, or -1 if it isn't known.
+	Size int64 `json:",omitempty"`
+
+	// Perms are the permissions the file will end up with for download and chmod operations.
+	Perms int `json:",omitempty"`
+}
+
+// Simulation holds the results of simulating a client update.
+type Simulation struct {
+	// Source is the directory or version ID that was updated from.
+	Source   string
+	TargetId int
+
+	Operations []Operation
+
+	Downloads    int
+	Deletes      int
+	Chmods       int
+	Untracked    int
+	DownloadSize int64
+
+	// UnknownSizes is the number of downloads whose size couldn't be determined. These aren't included in DownloadSize.
+	UnknownSizes int
+}
+
+// Simulate works out the operations needed to update the given source (a local installation directory or a version ID) to the given target version.
+// Clients only delete files that belonged to the version they have installed. If the source is a directory, installedId is the ID of the version it was installed from, or -1 if it isn't known, in which case none of its files would be deleted.
+func Simulate(repoDir, filesDir, source string, targetId, installedId int) (Simulation, subcmd.Error) {
+	errFmt := fmt.Sprintf("Can't simulate updating '%s' to version %d: %%s", source, targetId)
+
+	if err := repoutil.CheckRepoDir(repoDir); err != nil {
+		return Simulation{}, subcmd.WrapError(errFmt, err)
+	}
+
+	targetVersion, targetErr := repoutil.LoadVersion(repoDir, targetId)
+	if targetErr != nil {
+		return Simulation{}, subcmd.WrapError(errFmt, targetErr)
+	}
+
+	var sourceVersion repo.Version
+	// installedFiles are the paths of the files the client would delete if the target version doesn't have them, or nil if every such file would be deleted.
+	var installedFiles map[string]bool
+	if info, statErr := os.Stat(source); statErr == nil && info.IsDir() {
+		installedFiles = map[string]bool{}
+		if installedId >= 0 {
+			installed, loadErr := repoutil.LoadVersion(repoDir, installedId)
+			if loadErr != nil {
+				return Simulation{}, subcmd.WrapError(errFmt, loadErr)
+			}
+			for _, file := range installed.Files {
+				installedFiles[file.Path] = true
+			}
+		}
+
+		var localErr error
+		sourceVersion, localErr = localVersion(source)
+		if localErr != nil {
+			return Simulation{}, subcmd.CausedError(fmt.Sprintf(errFmt, "Failed to calculate MD5s for the installation directory."), 30, localErr)
+		}
+	} else if sourceId, parseErr := strconv.ParseInt(source, 10, 0); parseErr == nil {
+		loaded, loadErr := repoutil.LoadVersion(repoDir, int(sourceId))
+		if loadErr != nil {
+			return Simulation{}, subcmd.WrapError(errFmt, loadErr)
+		}
+		sourceVersion = loaded.Version
+	} else {
+		return Simulation{}, subcmd.UsageError(fmt.Sprintf("Source '%s' is neither an existing directory nor a version ID.", source))
+	}
+
+	changes := diff.DiffVersions(sourceVersion, targetVersion.Version, filesDir)
+
+	result := Simulation{Source: source, TargetId: targetId, Operations: []Operation{}, DownloadSize: changes.DownloadSize, UnknownSizes: changes.UnknownSizes}
+	for _, change := range append(changes.Added, changes.Modified...) {
+		result.Operations = append(result.Operations, Operation{Type: "download", Path: change.Path, Size: change.Size, Perms: change.NewPerms})
+		result.Downloads++
+	}
+	for _, change := range changes.Removed {
+		if installedFiles != nil && !installedFiles[change.Path] {
+			result.Operations = append(result.Operations, Operation{Type: "untracked", Path: change.Path})
+			result.Untracked++
+			continue
+		}
+		result.Operations = append(result.Operations, Operation{Type: "delete", Path: change.Path})
+		result.Deletes++
+	}
+	for _, change := range changes.PermsChanged {
+		result.Operations = append(result.Operations, Operation{Type: "chmod", Path: change.Path, Perms: change.NewPerms})
+		result.Chmods++
+	}
+
+	return result, nil
+}
+
+// localVersion builds a version structure describing the files in the given installation directory.
+func localVersion(installDir string) (repo.Version, error) {
+	version := repo.NewVersion(-1, installDir)
+
+	files, bytes := progress.Measure(installDir)
+	report := progress.New("Hashing installation", files, bytes)
+	md5s, err := md5util.RecursiveMD5CalcProgress(installDir, []string{}, report)
+	report.Done()
+	if err != nil {
+		return version, err
+	}
+
+	for _, md5Data := range md5s {
+		info, statErr := os.Stat(filepath.Join(installDir, md5Data.Path))
+		if statErr != nil {
+			return version, statErr
+		}
+		perms := info.Mode().Perm()
+
+		version.Files = append(version.Files, repo.FileInfo{Path: filepath.ToSlash(md5Data.Path), MD5: md5Data.MD5, Perms: int(perms), Executable: (perms & 0111) != 0})
+	}
+
+	return version, nil
+}
+
+// PrintText prints a human-readable summary of the simulation.
+func (result Simulation) PrintText(w io.Writer) {
+	fmt.Fprintf(w, "Updating %s to version %d:\n", result.Source, result.TargetId)
+
+	for _, op := range result.Operations {
+		switch op.Type {
+		case "download":
+			fmt.Fprintf(w, "  download %s (%s)\n", op.Path, repoutil.FormatSize(op.Size))
+		case "delete":
+			fmt.Fprintf(w, "  delete   %s\n", op.Path)
+		case "chmod":
+			fmt.Fprintf(w, "  chmod    %s (%s)\n", op.Path, os.FileMode(op.Perms))
+		case "untracked":
+			fmt.Fprintf(w, "  keep     %s (untracked)\n", op.Path)
+		}
+	}
+
+	fmt.Fprintf(w, "%d downloads, %d deletions, %d permission changes", result.Downloads, result.Deletes, result.Chmods)
+	if result.Untracked > 0 {
+		fmt.Fprintf(w, ", %d untracked files", result.Untracked)
+	}
+	fmt.Fprintln(w, ".")
+	fmt.Fprintf(w, "Download size: %s", repoutil.FormatSize(result.DownloadSize))
+	if result.UnknownSizes > 0 {
+		fmt.Fprintf(w, " (plus %d files of unknown size)", result.UnknownSizes)
+	}
+	fmt.Fprintln(w)
+}
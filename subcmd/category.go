@@ -0,0 +1,105 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package subcmd
+
+import (
+	"encoding/json"
+	"errors"
+	"io/fs"
+)
+
+// Category is the broad kind of an Error, so callers can handle errors without knowing every exit code.
+// Categories are errors themselves, so errors.Is(err, subcmd.NotFound) tells whether err is a not-found error.
+type Category int
+
+const (
+	// Unknown is the category of errors that don't fit any of the others, such as failed transfers and internal errors.
+	Unknown Category = iota
+
+	// Usage is the category of errors caused by bad arguments or options.
+	Usage
+
+	// NotFound is the category of errors caused by a missing repository, directory, file, channel, or version.
+	NotFound
+
+	// Permission is the category of errors caused by being denied access to a file or directory.
+	Permission
+
+	// Conflict is the category of errors caused by the repository being in a state that doesn't allow the change, such as a version or channel that already exists or a repository that is locked.
+	Conflict
+
+	// Corrupt is the category of errors caused by a file that can't be parsed or an index that isn't valid.
+	Corrupt
+)
+
+var categoryNames = map[Category]string{
+	Unknown:    "unknown",
+	Usage:      "usage",
+	NotFound:   "not-found",
+	Permission: "permission",
+	Conflict:   "conflict",
+	Corrupt:    "corrupt",
+}
+
+// String returns the category's name, such as "not-found".
+func (category Category) String() string {
+	return categoryNames[category]
+}
+
+// Error returns the category's name, so categories can be compared against with errors.Is.
+func (category Category) Error() string {
+	return category.String()
+}
+
+// MarshalText marshals the category as its name.
+func (category Category) MarshalText() ([]byte, error) {
+	return []byte(category.String()), nil
+}
+
+// exitCodeCategories maps the documented exit codes to their categories. Exit codes that aren't listed are Unknown.
+// Some exit codes are shared by errors of different kinds, so an error's cause is checked before its exit code.
+var exitCodeCategories = map[int]Category{
+	-1: Usage,
+
+	10: NotFound, 11: NotFound, 12: NotFound, 13: NotFound, 14: NotFound, 16: NotFound,
+
+	15: Corrupt, 17: Corrupt, 18: Corrupt, 19: Corrupt, 50: Corrupt, 52: Corrupt,
+
+	20: Permission, 21: Permission, 22: Permission, 23: Permission, 24: Permission,
+	25: Permission, 26: Permission, 27: Permission, 28: Permission, 29: Permission, 45: Permission,
+
+	44: Conflict, 46: Conflict, 47: Conflict, 48: Conflict, 49: Conflict, 51: Conflict, 53: Conflict,
+}
+
+// categorize works out the category of an error with the given exit code and cause.
+func categorize(exitCode int, cause error) Category {
+	var cmdErr Error
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case cause == nil:
+	case errors.As(cause, &cmdErr):
+		return cmdErr.Category()
+	case errors.Is(cause, fs.ErrNotExist):
+		return NotFound
+	case errors.Is(cause, fs.ErrPermission):
+		return Permission
+	case errors.Is(cause, fs.ErrExist):
+		return Conflict
+	case errors.As(cause, &syntaxErr), errors.As(cause, &typeErr):
+		return Corrupt
+	}
+	return exitCodeCategories[exitCode]
+}
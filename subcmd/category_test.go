@@ -0,0 +1,101 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package subcmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestCategorize(t *testing.T) {
+	_, statErr := os.Stat("/nonexistent/repoman-test")
+	syntaxErr := json.Unmarshal([]byte("{"), &struct{}{})
+
+	tests := []struct {
+		exitCode int
+		cause    error
+		category Category
+	}{
+		{-1, nil, Usage},
+		{0, nil, Unknown},
+		{10, nil, NotFound},
+		{17, nil, Corrupt},
+		{45, nil, Permission},
+		{51, nil, Conflict},
+		{53, nil, Conflict},
+		{42, nil, Unknown},
+		{999, nil, Unknown},
+
+		// Causes are checked before exit codes.
+		{-2, statErr, NotFound},
+		{20, os.ErrPermission, Permission},
+		{10, os.ErrExist, Conflict},
+		{-2, fmt.Errorf("reading: %w", os.ErrNotExist), NotFound},
+		{-2, syntaxErr, Corrupt},
+		{42, errors.New("transfer failed"), Unknown},
+		{-2, MessageError("No such channel.", 16), NotFound},
+		{-2, CategoryError(Conflict, "Locked.", 99, nil), Conflict},
+	}
+
+	for _, test := range tests {
+		if category := categorize(test.exitCode, test.cause); category != test.category {
+			t.Errorf("categorize(%d, %v) = %s, want %s", test.exitCode, test.cause, category, test.category)
+		}
+	}
+}
+
+func TestErrorsIsCategory(t *testing.T) {
+	notFound := MessageError("No such version.", 14)
+	wrapped := WrapError("Can't set channel: %s", notFound)
+	caused := CausedError("Can't read the index.", -2, notFound)
+
+	tests := []struct {
+		err      error
+		category Category
+		want     bool
+	}{
+		{notFound, NotFound, true},
+		{notFound, Corrupt, false},
+		{wrapped, NotFound, true},
+		{caused, NotFound, true},
+		{fmt.Errorf("daemon: %w", caused), NotFound, true},
+		{UsageError("Bad arguments."), Usage, true},
+		{UsageError("Bad arguments."), Unknown, false},
+		{CausedError("Denied.", 45, nil), Permission, true},
+		{CausedError("Can't write.", -2, os.ErrPermission), Permission, true},
+		{errors.New("plain"), Unknown, false},
+	}
+
+	for _, test := range tests {
+		if got := errors.Is(test.err, test.category); got != test.want {
+			t.Errorf("errors.Is(%q, %s) = %v, want %v", test.err, test.category, got, test.want)
+		}
+	}
+
+	// The cause chain stays visible to errors.Is.
+	if !errors.Is(CausedError("Can't write.", -2, os.ErrPermission), os.ErrPermission) {
+		t.Error("errors.Is doesn't see an Error's cause")
+	}
+}
+
+func TestCategoryMarshal(t *testing.T) {
+	data, err := json.Marshal(struct{ Category Category }{NotFound})
+	if err != nil || string(data) != `{"Category":"not-found"}` {
+		t.Errorf("json.Marshal(NotFound) = %s, %v", data, err)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package subcmd
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"strings"
+)
+
+// FlagCommand is a Command that takes named options in addition to its arguments.
+// Commands that implement it should be registered as pointers, so the values SetFlags binds the flags to are the ones Execute sees.
+type FlagCommand interface {
+	Command
+
+	// SetFlags defines the command's options on the given flag set. It is called before the command's arguments are parsed.
+	SetFlags(flags *flag.FlagSet)
+}
+
+// HelpRequested is returned by ParseFlags when the arguments ask for help with -h or --help. The command's help should be shown instead of running it.
+var HelpRequested Error = msgError{msg: "", exitCode: 0}
+
+// NewFlagSet returns a flag set with the given command's options defined on it, along with the global options that every command takes.
+func NewFlagSet(name string, cmd Command) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	// Parse errors are returned as usage errors rather than printed by the flag package.
+	flags.SetOutput(ioutil.Discard)
+	addGlobalFlags(flags)
+	if flagCmd, ok := cmd.(FlagCommand); ok {
+		flagCmd.SetFlags(flags)
+	}
+	return flags
+}
+
+// ParseFlags parses the given command's options out of args and returns the remaining arguments.
+// Unlike flag.FlagSet.Parse, options may come before, after, or between the arguments. Everything after a "--" argument is treated as an argument.
+func ParseFlags(name string, cmd Command, args []string) ([]string, Error) {
+	flags := NewFlagSet(name, cmd)
+
+	remaining := []string{}
+	for {
+		if err := flags.Parse(args); err == flag.ErrHelp {
+			return nil, HelpRequested
+		} else if err != nil {
+			return nil, UsageError(err.Error())
+		}
+
+		rest := flags.Args()
+		if len(rest) == 0 {
+			return remaining, nil
+		}
+		// Parse stops at the first argument that isn't an option, or just after a "--".
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			return append(remaining, rest...), nil
+		}
+		remaining = append(remaining, rest[0])
+		args = rest[1:]
+	}
+}
+
+// FlagHelp returns the help text for the given command's options, or a blank string if it has none.
+func FlagHelp(cmd Command) string {
+	flags := NewFlagSet("", cmd)
+
+	buf := &bytes.Buffer{}
+	flags.SetOutput(buf)
+	flags.PrintDefaults()
+	return strings.TrimRight(buf.String(), "\n")
+}
+
+// FullUsage returns the given command's Usage string, with an [OPTIONS] placeholder in front of it if the command has options.
+func FullUsage(cmd Command) string {
+	if FlagHelp(cmd) == "" {
+		return cmd.Usage()
+	}
+	return strings.TrimSpace("[OPTIONS] " + cmd.Usage())
+}
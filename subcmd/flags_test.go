@@ -0,0 +1,85 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package subcmd
+
+import (
+	"flag"
+	"reflect"
+	"testing"
+)
+
+// flagTestCommand is a command with a string option and a bool option for testing option parsing.
+type flagTestCommand struct {
+	name  string
+	force bool
+}
+
+func (cmd *flagTestCommand) Execute(args ...string) Error { return nil }
+func (cmd *flagTestCommand) Summary() string              { return "" }
+func (cmd *flagTestCommand) Description() string          { return "" }
+func (cmd *flagTestCommand) Usage() string                { return "ARG..." }
+func (cmd *flagTestCommand) ArgHelp() string              { return "" }
+func (cmd *flagTestCommand) SetFlags(flags *flag.FlagSet) {
+	flags.StringVar(&cmd.name, "name", "", "")
+	flags.BoolVar(&cmd.force, "force", false, "")
+}
+
+func TestParseFlags(t *testing.T) {
+	tests := []struct {
+		args  []string
+		rest  []string
+		name  string
+		force bool
+	}{
+		{args: []string{}, rest: []string{}},
+		{args: []string{"a", "b"}, rest: []string{"a", "b"}},
+		{args: []string{"--name", "x", "a", "b"}, rest: []string{"a", "b"}, name: "x"},
+		{args: []string{"a", "--name=x", "b"}, rest: []string{"a", "b"}, name: "x"},
+		{args: []string{"a", "b", "-force"}, rest: []string{"a", "b"}, force: true},
+		{args: []string{"--force", "a", "--name", "x", "b"}, rest: []string{"a", "b"}, name: "x", force: true},
+		{args: []string{"a", "--", "--force", "b"}, rest: []string{"a", "--force", "b"}},
+		{args: []string{"--name", "x", "--", "--name", "y"}, rest: []string{"--name", "y"}, name: "x"},
+		{args: []string{"--", "--"}, rest: []string{"--"}},
+		{args: []string{"a", "-"}, rest: []string{"a", "-"}},
+	}
+
+	for _, test := range tests {
+		cmd := &flagTestCommand{}
+		rest, err := ParseFlags("test", cmd, test.args)
+		if err != nil {
+			t.Errorf("ParseFlags(%q) returned error: %s", test.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(rest, test.rest) || cmd.name != test.name || cmd.force != test.force {
+			t.Errorf("ParseFlags(%q) = %q, name %q, force %v; want %q, name %q, force %v", test.args, rest, cmd.name, cmd.force, test.rest, test.name, test.force)
+		}
+	}
+}
+
+func TestParseFlagsErrors(t *testing.T) {
+	for _, args := range [][]string{{"--bogus"}, {"a", "--name"}, {"--force=maybe"}} {
+		if _, err := ParseFlags("test", &flagTestCommand{}, args); err == nil || err == HelpRequested || !err.ShowUsage() || err.Category() != Usage {
+			t.Errorf("ParseFlags(%q) returned %v, want a usage error", args, err)
+		}
+	}
+}
+
+func TestParseFlagsHelp(t *testing.T) {
+	for _, args := range [][]string{{"a", "-h"}, {"--help", "a"}} {
+		if _, err := ParseFlags("test", &flagTestCommand{}, args); err != HelpRequested {
+			t.Errorf("ParseFlags(%q) returned %#v, want HelpRequested", args, err)
+		}
+	}
+}
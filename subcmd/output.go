@@ -0,0 +1,210 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package subcmd
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// The output formats that the global --output option can pick.
+const (
+	TextOutput = "text"
+	JSONOutput = "json"
+)
+
+// OutputFormat is the format commands print their results and errors in. It is set by the global --output option.
+var OutputFormat = TextOutput
+
+// Verbosity is how much RepoMan prints about what it is doing and why things failed. It is 0 normally, -1 with the global -q option, and goes up by one for each -v option.
+var Verbosity int
+
+// LogFile is the path of the file to append log entries to, set by the global --log-file option. It is blank if there is no log file.
+var LogFile string
+
+// verbosityFlag is the flag.Value for the -v and -q options. Setting it raises or lowers Verbosity by its value.
+type verbosityFlag int
+
+func (f verbosityFlag) String() string   { return "false" }
+func (f verbosityFlag) IsBoolFlag() bool { return true }
+
+func (f verbosityFlag) Set(value string) error {
+	if value == "true" {
+		changeVerbosity(int(f))
+	} else if value != "false" {
+		return fmt.Errorf("invalid value %q", value)
+	}
+	return nil
+}
+
+// changeVerbosity handles a -v option, which raises Verbosity by one, or a -q option, which lowers it to -1.
+func changeVerbosity(change int) {
+	if change < 0 {
+		Verbosity = -1
+	} else if Verbosity < 0 {
+		Verbosity = 1
+	} else {
+		Verbosity++
+	}
+}
+
+// SetVerbosity handles a -v, --verbose, -q, or --quiet option given before the command. It returns false if the given argument isn't one of them.
+func SetVerbosity(arg string) bool {
+	if !strings.HasPrefix(arg, "-") {
+		return false
+	}
+	switch strings.TrimLeft(arg, "-") {
+	case "v", "verbose":
+		changeVerbosity(1)
+	case "q", "quiet":
+		changeVerbosity(-1)
+	default:
+		return false
+	}
+	return true
+}
+
+// addGlobalFlags defines the options that every command takes on the given flag set.
+func addGlobalFlags(flags *flag.FlagSet) {
+	flags.Var(outputFlag{}, "output", "Print results and errors as `FORMAT`: text or json.")
+	flags.Var(verbosityFlag(1), "v", "Print more detail: every cause of an error, and info log entries. Give twice for debug log entries.")
+	flags.Var(verbosityFlag(1), "verbose", "Same as -v.")
+	flags.Var(verbosityFlag(-1), "q", "Print less detail: no causes of errors, no log entries, and no progress.")
+	flags.Var(verbosityFlag(-1), "quiet", "Same as -q.")
+	flags.StringVar(&LogFile, "log-file", LogFile, "Append every log entry to `FILE`.")
+}
+
+// FormatError returns the text to print for the given error, depending on Verbosity.
+// Normally that's the error's message and its first cause. -q leaves out the cause, and -v adds all of the causes along with the error's category and exit code.
+func FormatError(err Error) string {
+	causes := CauseChain(err)
+	switch {
+	case Verbosity < 0:
+		causes = nil
+	case Verbosity == 0 && len(causes) > 1:
+		causes = causes[:1]
+	}
+
+	msg := err.Error()
+	for _, cause := range causes {
+		msg += fmt.Sprintf("\n  Caused by: %s", cause)
+	}
+	if Verbosity > 0 {
+		msg += fmt.Sprintf("\n  Category: %s, exit code %d", err.Category(), err.ExitCode())
+	}
+	return msg
+}
+
+// Result is what a command produced. In JSON output mode it is marshalled as is, so its exported fields should describe everything the command did.
+type Result interface {
+	// PrintText prints the result in the form meant for people to read. Results of commands that normally print nothing may print nothing.
+	PrintText(w io.Writer)
+}
+
+// SetOutputFormat sets OutputFormat, returning an error if the given format isn't one of the known ones.
+func SetOutputFormat(format string) error {
+	if format != TextOutput && format != JSONOutput {
+		return fmt.Errorf("output format must be %s or %s", TextOutput, JSONOutput)
+	}
+	OutputFormat = format
+	return nil
+}
+
+// outputFlag is the flag.Value for the --output option.
+type outputFlag struct{}
+
+func (f outputFlag) String() string         { return OutputFormat }
+func (f outputFlag) Set(value string) error { return SetOutputFormat(value) }
+
+// JSON returns true if results and errors should be printed as JSON.
+func JSON() bool {
+	return OutputFormat == JSONOutput
+}
+
+// PrintResult prints the given result to standard output in the chosen output format.
+func PrintResult(result Result) {
+	if !JSON() {
+		result.PrintText(os.Stdout)
+		return
+	}
+	if err := writeJSON(os.Stdout, result); err != nil {
+		// Results are plain data, so this shouldn't happen...
+		fmt.Fprintf(os.Stderr, "Failed to marshal the result to JSON: %s\n", err)
+	}
+}
+
+// writeJSON writes the given value to w as indented JSON. Characters like "<" and ">" are left alone, since the output isn't meant for HTML.
+func writeJSON(w io.Writer, value interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "    ")
+	return encoder.Encode(value)
+}
+
+// Messages returns where commands should print messages that aren't part of their result.
+// That's standard output normally, but standard error in JSON output mode so standard output is only the JSON result.
+func Messages() io.Writer {
+	if JSON() {
+		return os.Stderr
+	}
+	return os.Stdout
+}
+
+// jsonError is how errors are printed in JSON output mode.
+type jsonError struct {
+	Error struct {
+		Message  string
+		ExitCode int
+		Category Category
+
+		// Causes are the messages of the errors that caused this one, outermost first.
+		Causes []string `json:",omitempty"`
+
+		// Usage is the usage of the command that failed, if the error was a usage error.
+		Usage string `json:",omitempty"`
+	}
+}
+
+// PrintErrorJSON prints the given error as a JSON object to standard error. If usage isn't blank, it is included.
+func PrintErrorJSON(err Error, usage string) {
+	out := jsonError{}
+	out.Error.Message = err.Error()
+	out.Error.ExitCode = err.ExitCode()
+	out.Error.Category = err.Category()
+	out.Error.Causes = CauseChain(err)
+	out.Error.Usage = usage
+
+	writeJSON(os.Stderr, out)
+}
+
+// CauseChain returns the messages of the errors that caused the given error, outermost first.
+// The chain follows Cause for command errors and errors.Unwrap for everything else.
+func CauseChain(err Error) []string {
+	causes := []string{}
+	for cause := err.Cause(); cause != nil; {
+		causes = append(causes, cause.Error())
+		if cmdErr, ok := cause.(Error); ok {
+			cause = cmdErr.Cause()
+		} else {
+			cause = errors.Unwrap(cause)
+		}
+	}
+	return causes
+}
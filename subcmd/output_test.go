@@ -0,0 +1,97 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package subcmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestSetOutputFormat(t *testing.T) {
+	defer func() { OutputFormat = TextOutput }()
+
+	tests := []struct {
+		format string
+		ok     bool
+	}{
+		{"text", true},
+		{"json", true},
+		{"JSON", false},
+		{"xml", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		OutputFormat = TextOutput
+		err := SetOutputFormat(test.format)
+		switch {
+		case test.ok && (err != nil || OutputFormat != test.format):
+			t.Errorf("SetOutputFormat(%q) = %v, OutputFormat %q", test.format, err, OutputFormat)
+		case !test.ok && (err == nil || OutputFormat != TextOutput):
+			t.Errorf("SetOutputFormat(%q) = %v, OutputFormat %q; want error and no change", test.format, err, OutputFormat)
+		}
+	}
+}
+
+func TestCauseChain(t *testing.T) {
+	root := errors.New("disk full")
+	tests := []struct {
+		err  Error
+		want []string
+	}{
+		{MessageError("No such channel.", 16), []string{}},
+		{CausedError("Can't write.", -2, root), []string{"disk full"}},
+		{CausedError("Can't update.", 42, fmt.Errorf("copying: %w", root)), []string{"copying: disk full", "disk full"}},
+		{CausedError("Can't update.", 42, CausedError("Can't write.", -2, root)), []string{"Can't write.", "disk full"}},
+		{WrapError("Can't update: %s", CausedError("Can't write.", -2, root)), []string{"disk full"}},
+	}
+	for _, test := range tests {
+		if got := CauseChain(test.err); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("CauseChain(%q) = %q, want %q", test.err, got, test.want)
+		}
+	}
+}
+
+func TestFormatError(t *testing.T) {
+	defer func() { Verbosity = 0 }()
+	err := CausedError("Can't update.", 42, CausedError("Can't write.", -2, errors.New("disk full")))
+
+	tests := []struct {
+		verbosity int
+		want      string
+	}{
+		{-1, "Can't update."},
+		{0, "Can't update.\n  Caused by: Can't write."},
+		{1, "Can't update.\n  Caused by: Can't write.\n  Caused by: disk full\n  Category: unknown, exit code 42"},
+	}
+	for _, test := range tests {
+		Verbosity = test.verbosity
+		if got := FormatError(err); got != test.want {
+			t.Errorf("FormatError at verbosity %d = %q, want %q", test.verbosity, got, test.want)
+		}
+	}
+}
+
+func TestWriteJSON(t *testing.T) {
+	buf := &bytes.Buffer{}
+	if err := writeJSON(buf, struct{ Message string }{"<a> & <b>"}); err != nil {
+		t.Fatal(err)
+	}
+	if want := "{\n    \"Message\": \"<a> & <b>\"\n}\n"; buf.String() != want {
+		t.Errorf("writeJSON wrote %q, want %q", buf.String(), want)
+	}
+}
@@ -20,6 +20,7 @@ package subcmd
 
 import (
 	"fmt"
+	"strings"
 )
 
 // Subcommand is an interface for RepoMan's subcommands to implement.
@@ -40,19 +41,32 @@ type Command interface {
 	ArgHelp() string
 }
 
+// Hidden returns true if the command with the given name is for RepoMan's own use, like the one the completion scripts call, and shouldn't be listed.
+func Hidden(name string) bool {
+	return strings.HasPrefix(name, "__")
+}
+
 // Error is an interface that provides information about an error that occurred while executing a subcommand.
+// Errors unwrap to their cause, so errors.Is and errors.As see the whole chain of causes. errors.Is(err, category) tells whether err is in the given Category.
 type Error interface {
-	// Implement the error interface.
+	// Implement the error interface. Error returns just this error's message, without its causes.
 	Error() string
 
-	// Message returns just this command's error message without the cause info that the Error function returns.
+	// Message returns this error's message followed by a "Caused by" line for each error in its chain of causes.
+	Message() string
 
 	// ExitCode specifies what the process's exit code should be when this error is returned.
 	ExitCode() int
 
+	// Category returns the broad kind of error this is.
+	Category() Category
+
 	// Cause specifies another error that caused this command error. May also be nil if there was no internal error that caused this error.
 	Cause() error
 
+	// Unwrap returns the same error as Cause, for errors.Is and errors.As.
+	Unwrap() error
+
 	// ShowUsage returns true if the Usage information for the command that returned this error should be printed after the command's Error string.
 	ShowUsage() bool
 }
@@ -68,6 +82,8 @@ type msgError struct {
 	// cause is the error that caused this command error. May be nil.
 	cause error
 
+	category Category
+
 	printUsage bool
 }
 
@@ -76,40 +92,62 @@ func (err msgError) Error() string {
 	return err.msg
 }
 
-// Message returns the full message that should be printed when this error occurs. This includes the cause's message if there is one.
+// Message returns the full message that should be printed when this error occurs. This includes the messages of all of its causes.
 func (err msgError) Message() string {
 	msg := err.msg
-	cause := err.cause
-	if cause == nil {
-		return msg
-	} else {
-		return fmt.Sprintf("%s\n  Caused by: %s", msg, cause)
+	for _, cause := range CauseChain(err) {
+		msg += fmt.Sprintf("\n  Caused by: %s", cause)
 	}
+	return msg
 }
 
 func (err msgError) ExitCode() int {
 	return err.exitCode
 }
 
+func (err msgError) Category() Category {
+	return err.category
+}
+
 func (err msgError) Cause() error {
 	return err.cause
 }
 
+func (err msgError) Unwrap() error {
+	return err.cause
+}
+
+// Is returns true if target is this error's category.
+func (err msgError) Is(target error) bool {
+	category, ok := target.(Category)
+	return ok && category == err.category
+}
+
 func (err msgError) ShowUsage() bool {
 	return err.printUsage
 }
 
-// CausedError returns an Error with the given message, exit code, and cause.
+// CausedError returns an Error with the given message, exit code, and cause. Its category is worked out from the cause, or from the exit code if the cause doesn't tell.
 func CausedError(message string, exitCode int, cause error) Error {
-	return msgError{msg: message, exitCode: exitCode, cause: cause, printUsage: false}
+	return msgError{msg: message, exitCode: exitCode, cause: cause, category: categorize(exitCode, cause), printUsage: false}
 }
 
-// MessageError returns an Error with the given message and exit code.
+// MessageError returns an Error with the given message and exit code. Its category is worked out from the exit code.
 func MessageError(message string, exitCode int) Error {
-	return msgError{msg: message, exitCode: exitCode, cause: nil, printUsage: false}
+	return msgError{msg: message, exitCode: exitCode, cause: nil, category: categorize(exitCode, nil), printUsage: false}
+}
+
+// CategoryError returns an Error with the given category, message, exit code, and cause, for errors whose category can't be worked out from their exit code and cause.
+func CategoryError(category Category, message string, exitCode int, cause error) Error {
+	return msgError{msg: message, exitCode: exitCode, cause: cause, category: category, printUsage: false}
 }
 
 // UsageError returns an Error that will print the command's usage info. If message isn't blank, it will be printed before the usage info.
 func UsageError(message string) Error {
-	return msgError{msg: message, exitCode: -1, cause: nil, printUsage: true}
+	return msgError{msg: message, exitCode: -1, cause: nil, category: Usage, printUsage: true}
+}
+
+// WrapError returns a copy of the given Error whose message is formatted into the given format string, which should contain a single %s. The exit code, category, cause, and usage flag are kept.
+func WrapError(format string, err Error) Error {
+	return msgError{msg: fmt.Sprintf(format, err.Error()), exitCode: err.ExitCode(), cause: err.Cause(), category: err.Category(), printUsage: err.ShowUsage()}
 }
@@ -16,6 +16,7 @@ package update
 
 import (
 	"encoding/json"
+	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -24,14 +25,30 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/MultiMC/repoman/config"
+	"github.com/MultiMC/repoman/logging"
 	"github.com/MultiMC/repoman/md5util"
+	"github.com/MultiMC/repoman/progress"
+	"github.com/MultiMC/repoman/publish"
+	"github.com/MultiMC/repoman/repoutil"
 	"github.com/MultiMC/repoman/subcmd"
 
 	"github.com/MultiMC/GoUpdate/repo"
 )
 
-type Command struct{}
+var log = logging.New("update")
+
+type Command struct {
+	// metaOptions collects the metadata options in the OPTION=VALUE form ParseMetaOptions takes.
+	metaOptions []string
+
+	filesDir     string
+	urlBase      string
+	transferMode string
+	hashes       string
+}
 
 func (cmd Command) Summary() string {
 	return "Updates a given repository with the files in a given directory."
@@ -40,33 +57,157 @@ func (cmd Command) Description() string {
 	return "The update command updates a given repository with a set of files in a given directory. It then creates a new version for those files based on the given arguments."
 }
 func (cmd Command) Usage() string {
-	return "REPO_DIR FILE_STORAGE URL_BASE UPDATE_DIR VERSION_NAME VERSION_ID"
+	return "REPO_DIR [FILE_STORAGE URL_BASE] UPDATE_DIR VERSION_NAME [VERSION_ID]"
 }
 func (cmd Command) ArgHelp() string {
-	return "REPO_DIR - The directory name of the repository to update.\nFILE_STORAGE - The path to the directory where the update files will be stored.\nURL_BASE - The base URL to use to create HTTP sources in the new version. This should point to the file storage directory so any files in the file storage directory can be accessed via this base URL.\nUPDATE_DIR - The directory containing the new version's files.\nVERSION_NAME - The version name (e.g. 4.3.0.42) of the new version.\nVERSION_ID - The new version's integer ID."
+	return "REPO_DIR - The directory name of the repository to update.\nFILE_STORAGE - The path to the directory where the update files will be stored. May be left out, along with URL_BASE, or given as \"-\" if the repository's configuration sets it.\nURL_BASE - The base URL to use to create HTTP sources in the new version. This should point to the file storage directory so any files in the file storage directory can be accessed via this base URL. May be left out, along with FILE_STORAGE, or given as \"-\" if the repository's configuration sets it.\nUPDATE_DIR - The directory containing the new version's files.\nVERSION_NAME - The version name (e.g. 4.3.0.42) of the new version.\nVERSION_ID - The new version's integer ID. If not specified or \"auto\", the version is given an ID one higher than the highest existing version ID. The ID used is printed to standard output as VERSION_ID=<id>."
+}
+
+func (cmd *Command) SetFlags(flags *flag.FlagSet) {
+	flags.Var(metaFlag{"notes", &cmd.metaOptions}, "notes", "The new version's release `NOTES`, in Markdown.")
+	flags.Var(metaFlag{"notes-file", &cmd.metaOptions}, "notes-file", "Read the release notes from the given Markdown `FILE`.")
+	flags.Var(metaFlag{"time", &cmd.metaOptions}, "time", "The release `TIME` in RFC 3339 format (e.g. 2013-11-05T17:00:00Z). Defaults to now.")
+	flags.Var(metaFlag{"commit", &cmd.metaOptions}, "commit", "The `HASH` of the commit the version was built from.")
+	flags.Var(metaFlag{"build", &cmd.metaOptions}, "build", "Arbitrary build information as `KEY=VALUE`. May be given more than once.")
+	flags.StringVar(&cmd.filesDir, "storage", "", "The file storage `DIR`, if FILE_STORAGE isn't given. Overrides the configured one.")
+	flags.StringVar(&cmd.urlBase, "url-base", "", "The base `URL` for HTTP sources, if URL_BASE isn't given. Overrides the configured one.")
+	flags.StringVar(&cmd.transferMode, "transfer", "", "How to get new files into storage: copy, link, or move. Overrides the configured transfer `MODE`.")
+	repoutil.AddDryRunFlag(flags)
+	publish.AddPurgeListFlag(flags)
+	flags.StringVar(&cmd.hashes, "hash", "", "Comma separated `ALGORITHMS` to record extra hashes with (sha1, sha256, or sha512). Overrides the configured ones.")
+}
+
+// metaFlag is a flag.Value that adds an OPTION=VALUE string to a list of metadata options each time it is set.
+// The build flag takes KEY=VALUE itself, so it adds build.KEY=VALUE.
+type metaFlag struct {
+	key     string
+	options *[]string
+}
+
+func (f metaFlag) String() string { return "" }
+
+func (f metaFlag) Set(value string) error {
+	if f.key == "build" {
+		if !strings.Contains(value, "=") {
+			return fmt.Errorf("build information must be of the form KEY=VALUE")
+		}
+		*f.options = append(*f.options, "build."+value)
+	} else {
+		*f.options = append(*f.options, f.key+"="+value)
+	}
+	return nil
 }
 
 func (cmd Command) Execute(args ...string) subcmd.Error {
-	if len(args) < 6 {
-		return subcmd.UsageError("'update' command requires at least six arguments.")
+	if len(args) < 3 || len(args) > 6 {
+		return subcmd.UsageError("'update' command requires between three and six arguments.")
 	} else {
 		repoDir := args[0]
-		filesDir := args[1]
-		urlBase := args[2]
-		newVersionDir := args[3]
-		versionName := args[4]
-		versionIdStr := args[5]
-
-		versionId, err := strconv.ParseInt(versionIdStr, 10, 0)
-
-		if err != nil {
-			return subcmd.UsageError("Version ID must be a positive integer.")
-		} else {
-			return UpdateRepo(repoDir, filesDir, urlBase, newVersionDir, versionName, int(versionId))
+		positional := args[1:]
+
+		// FILE_STORAGE and URL_BASE can only be left out together, so with five or more arguments they are there.
+		filesArg, urlBaseArg := "", ""
+		if len(positional) >= 4 {
+			filesArg, urlBaseArg = positional[0], positional[1]
+			positional = positional[2:]
+		}
+
+		newVersionDir := positional[0]
+		versionName := positional[1]
+		versionIdStr := "auto"
+		if len(positional) >= 3 {
+			versionIdStr = positional[2]
 		}
+
+		cfg, cfgErr := config.Load(repoDir)
+		if cfgErr != nil {
+			return cfgErr
+		}
+		cfg.FileStorage = config.Pick(filesArg, config.Pick(cmd.filesDir, cfg.FileStorage))
+		cfg.URLBase = config.Pick(urlBaseArg, config.Pick(cmd.urlBase, cfg.URLBase))
+		cfg.TransferMode = config.Pick(cmd.transferMode, cfg.TransferMode)
+		if cmd.hashes != "" {
+			cfg.HashAlgorithms = config.SplitList(cmd.hashes)
+		}
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+		if err := config.Require(cfg.FileStorage, "file storage directory"); err != nil {
+			return err
+		}
+		if err := config.Require(cfg.URLBase, "URL base"); err != nil {
+			return err
+		}
+
+		meta, optErr := ParseMetaOptions(cmd.metaOptions)
+		if optErr != nil {
+			return optErr
+		}
+
+		versionId := int64(AutoVersionId)
+		if versionIdStr != "auto" {
+			var err error
+			versionId, err = strconv.ParseInt(versionIdStr, 10, 0)
+			if err != nil || versionId < 0 {
+				return subcmd.UsageError("Version ID must be a positive integer or \"auto\".")
+			}
+		}
+
+		return repoutil.WithLock(repoDir, func() subcmd.Error {
+			result, err := UpdateRepo(repoDir, cfg, newVersionDir, versionName, int(versionId), meta)
+			if err == nil {
+				subcmd.PrintResult(result)
+			}
+			return err
+		})
 	}
 }
 
+// ParseMetaOptions builds version metadata from OPTION=VALUE strings, where OPTION is notes, notes-file, time, commit, or build.KEY.
+func ParseMetaOptions(options []string) (meta repoutil.VersionMeta, err subcmd.Error) {
+	for _, option := range options {
+		parts := strings.SplitN(option, "=", 2)
+		if len(parts) < 2 {
+			return meta, subcmd.UsageError(fmt.Sprintf("Invalid option '%s'. Options must be of the form OPTION=VALUE.", option))
+		}
+		key, value := parts[0], parts[1]
+
+		switch {
+		case key == "notes":
+			meta.ReleaseNotes = value
+		case key == "notes-file":
+			notes, readErr := ioutil.ReadFile(value)
+			if readErr != nil {
+				return meta, subcmd.CausedError(fmt.Sprintf("Failed to read release notes file %s.", value), 32, readErr)
+			}
+			meta.ReleaseNotes = string(notes)
+		case key == "time":
+			releaseTime, parseErr := time.Parse(time.RFC3339, value)
+			if parseErr != nil {
+				return meta, subcmd.UsageError(fmt.Sprintf("Invalid release time '%s'. Times must be in RFC 3339 format (e.g. 2013-11-05T17:00:00Z).", value))
+			}
+			meta.ReleaseTime = releaseTime.UTC()
+		case key == "commit":
+			meta.Commit = value
+		case strings.HasPrefix(key, "build.") && len(key) > len("build."):
+			if meta.Build == nil {
+				meta.Build = map[string]string{}
+			}
+			meta.Build[strings.TrimPrefix(key, "build.")] = value
+		default:
+			return meta, subcmd.UsageError(fmt.Sprintf("Unknown option '%s'.", key))
+		}
+	}
+
+	if meta.ReleaseTime.IsZero() {
+		meta.ReleaseTime = time.Now().UTC().Truncate(time.Second)
+	}
+	return
+}
+
+// AutoVersionId can be passed to UpdateRepo as the version ID to have it pick the next unused version ID.
+const AutoVersionId = -1
+
 // Structure for holding information about a file that already exists in the file storage directory.
 type fileStorageData struct {
 	// Path to this file relative to the file storage directory.
@@ -78,30 +219,78 @@ type fileStorageData struct {
 	MD5 string
 }
 
-func UpdateRepo(repoDir, filesDir, urlBase, newVersionDir, versionName string, versionId int) subcmd.Error {
+// Result describes the version an update added and what was done to get its files into storage.
+type Result struct {
+	repoutil.Change
+
+	VersionId   int
+	VersionName string
+
+	// Added lists the files that were transferred to file storage.
+	Added []StoredFile
+
+	// Reused is the number of the version's files that were already in file storage.
+	Reused int
+
+	// BytesCopied is the total size of the files in Added.
+	BytesCopied int64
+}
+
+// StoredFile is a file that an update transferred to file storage.
+type StoredFile struct {
+	// Path is where the file is installed.
+	Path string
+
+	// StoragePath is the file's path relative to the file storage directory.
+	StoragePath string
+
+	// Size is the file's size in bytes, or -1 if it couldn't be found out.
+	Size int64
+}
+
+// PrintText prints the new version's ID as VERSION_ID=<id>, so scripts can pick it up.
+func (result Result) PrintText(w io.Writer) {
+	fmt.Fprintf(w, "VERSION_ID=%d\n", result.VersionId)
+}
+
+// UpdateRepo adds a new version with the files in newVersionDir to the given repository and returns a description of what it did, including the new version's ID.
+// If versionId is AutoVersionId, the new version gets an ID one higher than the highest existing version ID. The caller should hold the repository's lock so that no other process can take the same ID.
+// The given metadata is stored in the version file and summarized in the index.
+// The file storage directory, URL base, transfer mode, and extra hash algorithms are taken from cfg, which should already be validated.
+func UpdateRepo(repoDir string, cfg config.Config, newVersionDir, versionName string, versionId int, meta repoutil.VersionMeta) (Result, subcmd.Error) {
+	result := Result{VersionId: versionId, VersionName: versionName, Added: []StoredFile{}}
 	fileMode := os.FileMode(0644)
+	filesDir := cfg.FileStorage
+	urlBase := cfg.URLBase
 	if !strings.HasSuffix(urlBase, "/") {
 		urlBase += "/"
 	}
 
-	// Make sure the repository directory exists.
-	if info, err := os.Stat(repoDir); err != nil {
-		var code int
-		var msg string
-		switch {
-		case os.IsNotExist(err):
-			msg = "Invalid repository: repository directory doesn't exist."
-			code = 10
-		case os.IsPermission(err):
-			msg = "Can't access repository directory: permission denied."
-			code = 20
-		default:
-			msg = "Can't access repository directory: an unknown error occurred."
-			code = -2
+	// Load the repository's index. This also makes sure the repository directory exists.
+	indexData, indexErr := repoutil.LoadIndex(repoDir)
+	if indexErr != nil {
+		return result, subcmd.WrapError(fmt.Sprintf("Can't update repository %s: %%s", repoDir), indexErr)
+	}
+
+	// Pick the next version ID if we weren't given one.
+	if versionId == AutoVersionId {
+		versionId = 1
+		for _, version := range indexData.Versions {
+			if version.Id >= versionId {
+				versionId = version.Id + 1
+			}
+		}
+		result.VersionId = versionId
+		log.Debug("Picked version ID", "id", versionId)
+	}
+
+	// Version IDs must be unique and increasing, so check that before we do any real work.
+	for _, version := range indexData.Versions {
+		if version.Id == versionId {
+			return result, subcmd.MessageError(fmt.Sprintf("Can't update repository %s: Version %d already exists.", repoDir, versionId), 44)
+		} else if version.Id > versionId {
+			return result, subcmd.MessageError(fmt.Sprintf("Can't update repository %s: Version ID %d is lower than existing version ID %d. Version IDs must increase.", repoDir, versionId, version.Id), repoutil.InvalidIndexExitCode)
 		}
-		return subcmd.CausedError(fmt.Sprintf("Can't update repository %s: %s", repoDir, msg), code, err)
-	} else if !info.IsDir() {
-		return subcmd.MessageError(fmt.Sprintf("Can't update repository. The path %s is not a valid repository. Must be a directory.", repoDir), 10)
 	}
 
 	// Also make sure the file storage directory exists.
@@ -119,13 +308,13 @@ func UpdateRepo(repoDir, filesDir, urlBase, newVersionDir, versionName string, v
 			msg = "Can't access file storage directory: an unknown error occurred."
 			code = -2
 		}
-		return subcmd.CausedError(fmt.Sprintf("Can't update repository %s: %s", repoDir, msg), code, err)
+		return result, subcmd.CausedError(fmt.Sprintf("Can't update repository %s: %s", repoDir, msg), code, err)
 	} else if !info.IsDir() {
-		return subcmd.MessageError(fmt.Sprintf("The path %s is not a valid file storage directory. Must be a directory.", filesDir), 11)
+		return result, subcmd.MessageError(fmt.Sprintf("The path %s is not a valid file storage directory. Must be a directory.", filesDir), 11)
 	}
 
 	// And the new version's directory...
-	if info, err := os.Stat(filesDir); err != nil {
+	if info, err := os.Stat(newVersionDir); err != nil {
 		var code int
 		var msg string
 		switch {
@@ -139,49 +328,28 @@ func UpdateRepo(repoDir, filesDir, urlBase, newVersionDir, versionName string, v
 			msg = "Can't access new version directory: an unknown error occurred."
 			code = -2
 		}
-		return subcmd.CausedError(fmt.Sprintf("Can't update repository %s: %s", repoDir, msg), code, err)
+		return result, subcmd.CausedError(fmt.Sprintf("Can't update repository %s: %s", repoDir, msg), code, err)
 	} else if !info.IsDir() {
-		return subcmd.MessageError(fmt.Sprintf("The path %s is not a valid new version directory. Must be a directory.", filesDir), 12)
+		return result, subcmd.MessageError(fmt.Sprintf("The path %s is not a valid new version directory. Must be a directory.", newVersionDir), 12)
 	}
 
-	// Get the path to the index file.
-	indexFilePath := path.Join(repoDir, repo.IndexFileName)
-
-	// Try to read the index file.
-	fileData, indexErr := ioutil.ReadFile(indexFilePath)
-	if indexErr != nil {
-		// Handle errors.
-		var code int
-		var msg string
-		switch {
-		case os.IsNotExist(indexErr):
-			msg = "Invalid repository (%s): index file is missing."
-			code = 13
-		case os.IsPermission(indexErr):
-			msg = "Can't access repository's index file: permission denied."
-			code = 23
-		default:
-			msg = "An unknown error occurred when trying to read the repository's index file."
-			code = -2
-		}
-		return subcmd.CausedError(fmt.Sprintf("Can't update repository %s: %s", repoDir, msg), code, indexErr)
-	}
-
-	// Unmarshal the JSON.
-	var indexData repo.Index
-	if err := json.Unmarshal(fileData, &indexData); err != nil {
-		return subcmd.CausedError(fmt.Sprintf("Can't update repository %s: %s", repoDir), 12, err)
-	}
+	log.Info("Updating repository", "repo", repoDir, "version", versionName, "id", versionId, "source", newVersionDir, "storage", filesDir)
 
 	// TODO: Cache calculated MD5s for the file storage directory.
-	newVersionMD5s, nvMD5Err := md5util.RecursiveMD5Calc(newVersionDir, []string{})
+	nvFiles, nvBytes := progress.Measure(newVersionDir)
+	nvProgress := progress.New("Hashing new version", nvFiles, nvBytes)
+	newVersionMD5s, nvMD5Err := md5util.RecursiveMD5CalcProgress(newVersionDir, []string{}, nvProgress)
+	nvProgress.Done()
 	if nvMD5Err != nil {
-		return subcmd.CausedError(fmt.Sprintf("Can't update repository %s: Failed to calculate MD5s for new version directory (%s).", repoDir, filesDir), 30, nvMD5Err)
+		return result, subcmd.CausedError(fmt.Sprintf("Can't update repository %s: Failed to calculate MD5s for new version directory (%s).", repoDir, filesDir), 30, nvMD5Err)
 	}
 
-	fileStorageMD5s, fsMD5Err := md5util.RecursiveMD5Calc(filesDir, []string{})
+	fsFiles, fsBytes := progress.Measure(filesDir)
+	fsProgress := progress.New("Hashing file storage", fsFiles, fsBytes)
+	fileStorageMD5s, fsMD5Err := md5util.RecursiveMD5CalcProgress(filesDir, []string{}, fsProgress)
+	fsProgress.Done()
 	if fsMD5Err != nil {
-		return subcmd.CausedError(fmt.Sprintf("Can't update repository %s: Failed to calculate MD5s for file storage directory (%s).", repoDir, filesDir), 31, fsMD5Err)
+		return result, subcmd.CausedError(fmt.Sprintf("Can't update repository %s: Failed to calculate MD5s for file storage directory (%s).", repoDir, filesDir), 31, fsMD5Err)
 	}
 
 	// File storage map. This maps the install paths of files to their path within the file storage directory.
@@ -199,6 +367,7 @@ func UpdateRepo(repoDir, filesDir, urlBase, newVersionDir, versionName string, v
 			//fmt.Printf("%s vs %s", fsMD5Data, nvMD5Data)
 			if nvMD5Data.MD5 == fsMD5Data.MD5 {
 				// Map all the files we already have in storage.
+				log.Debug("Matched file in storage", "path", nvMD5Data.Path, "storage", fsMD5Data.Path, "md5", nvMD5Data.MD5)
 				fileStorageMap = append(fileStorageMap, fileStorageData{fsMD5Data.Path, nvMD5Data.Path, fsMD5Data.MD5})
 				break
 			} else if i == len(fileStorageMD5s)-1 {
@@ -214,6 +383,7 @@ func UpdateRepo(repoDir, filesDir, urlBase, newVersionDir, versionName string, v
 				prefixNum := -1
 				storageName := fmt.Sprintf("%s-%s", prefix, storageNameBase)
 				for _, err := os.Stat(path.Join(filesDir, storageName)); !os.IsNotExist(err); _, err = os.Stat(path.Join(filesDir, storageName)) {
+					log.Debug("Storage name is taken", "path", nvMD5Data.Path, "name", storageName)
 					if prefixSize < 32 {
 						prefixSize++
 					} else {
@@ -227,56 +397,97 @@ func UpdateRepo(repoDir, filesDir, urlBase, newVersionDir, versionName string, v
 					}
 				}
 
+				log.Debug("File isn't in storage", "path", nvMD5Data.Path, "storage", storageName, "md5", nvMD5Data.MD5)
 				addToStorage = append(addToStorage, fileStorageData{storageName, nvMD5Data.Path, nvMD5Data.MD5})
 			}
 		}
 	}
 
-	// Now, we need to go through our add to storage list, copy all the files into file storage, and add them to our file mapping.
+	// The files we're about to add to storage will be mapped too.
+	reused := fileStorageMap
+	result.Reused = len(reused)
 	for _, mapping := range addToStorage {
-		outFilePath := path.Join(filesDir, mapping.FileStoragePath)
-		fileOut, createErr := os.OpenFile(outFilePath, os.O_WRONLY | os.O_CREATE | os.O_EXCL, fileMode)
-		if createErr != nil {
-			return subcmd.CausedError(fmt.Sprintf("Failed updating repository %s. Couldn't create file %s.", repoDir, outFilePath), 42, createErr)
+		size := int64(-1)
+		if info, err := os.Stat(path.Join(newVersionDir, mapping.InstallPath)); err == nil {
+			size = info.Size()
+			result.BytesCopied += size
 		}
-		inFilePath := path.Join(newVersionDir, mapping.InstallPath)
-
-		fileIn, readErr := os.Open(inFilePath)
-		if readErr != nil {
-			return subcmd.CausedError(fmt.Sprintf("Failed updating repository %s. Couldn't read file %s.", repoDir, inFilePath), 43, readErr)
-		}
-		io.Copy(fileOut, fileIn)
-		fileStorageMap = append(fileStorageMap, mapping)
+		result.Added = append(result.Added, StoredFile{Path: mapping.InstallPath, StoragePath: mapping.FileStoragePath, Size: size})
 	}
+	fileStorageMap = append(fileStorageMap, addToStorage...)
 
 	// Now that we're done with that crap, we can start building the version object.
 
 	// Create the version data structure.
-	versionData := repo.NewVersion(versionId, versionName)
+	versionData := repoutil.Version{Version: repo.NewVersion(versionId, versionName), VersionMeta: meta}
+
+	// MD5 sums are always recorded in the file list, so they don't need to be in the extra hashes.
+	extraHashes := []string{}
+	for _, algorithm := range cfg.HashAlgorithms {
+		if algorithm != "md5" {
+			extraHashes = append(extraHashes, algorithm)
+		}
+	}
+	if len(extraHashes) > 0 {
+		versionData.Hashes = map[string]map[string]string{}
+	}
 
-	// Now, build the file list.
+	// Now, build the file list. This has to happen before the new files are transferred, since moving them removes them from the new version's directory.
 	for _, fsMapData := range fileStorageMap {
-		
 		inFilePath := path.Join(newVersionDir, fsMapData.InstallPath)
 		info, _ := os.Stat(inFilePath)
 		mode := info.Mode()
 		perms := mode.Perm()
-		
-		fileInfo := repo.FileInfo{Path: fsMapData.InstallPath, Sources: []repo.FileSource{}, MD5: fsMapData.MD5, Perms: int(perms), Executable: (perms & 0111) != 0}
 
-		
+		fileInfo := repo.FileInfo{Path: fsMapData.InstallPath, Sources: []repo.FileSource{}, MD5: fsMapData.MD5, Perms: int(perms), Executable: (perms & 0111) != 0}
 
 		// Add sources.
 		fileInfo.Sources = []repo.FileSource{repo.FileSource{SourceType: "http", Url: urlBase + fsMapData.FileStoragePath}}
 
 		versionData.Files = append(versionData.Files, fileInfo)
+
+		if len(extraHashes) > 0 {
+			sums, hashErr := md5util.HashFile(inFilePath, extraHashes)
+			if hashErr != nil {
+				return result, subcmd.CausedError(fmt.Sprintf("Can't update repository %s: Failed to calculate hashes for %s.", repoDir, inFilePath), 30, hashErr)
+			}
+			versionData.Hashes[fsMapData.InstallPath] = sums
+		}
+	}
+
+	// The new index is only missing the version, so the pre-hooks can be run on it before anything is written, and can stop the files from being transferred.
+	newIndex := indexData
+	newIndex.Versions = append(append([]repo.VersionSummary{}, indexData.Versions...), repo.VersionSummary{Id: versionId, Name: versionName})
+	if err := publish.BeginChange(repoDir, newIndex, storageURLs(urlBase, result.Added)); err != nil {
+		return result, subcmd.WrapError(fmt.Sprintf("Can't update repository %s: %%s", repoDir), err)
+	}
+
+	if repoutil.DryRun {
+		err := dryRunUpdate(repoDir, cfg, indexData, versionData, result, reused)
+		result.Change = repoutil.NewChange(repoDir)
+		return result, err
+	}
+
+	// Now, we need to go through our add to storage list and get all the files into file storage.
+	transferProgress := progress.New("Transferring files to storage", len(result.Added), result.BytesCopied)
+	for _, file := range result.Added {
+		outFilePath := path.Join(filesDir, file.StoragePath)
+		inFilePath := path.Join(newVersionDir, file.Path)
+		if err := transferFile(cfg.TransferMode, inFilePath, outFilePath, fileMode, transferProgress); err != nil {
+			transferProgress.Done()
+			return result, subcmd.CausedError(fmt.Sprintf("Failed updating repository %s. Couldn't %s file %s to %s.", repoDir, cfg.TransferMode, inFilePath, outFilePath), 42, err)
+		}
+		transferProgress.FileDone(file.Size)
+		log.Debug("Transferred file", "path", file.Path, "storage", file.StoragePath, "mode", cfg.TransferMode, "size", file.Size)
 	}
+	transferProgress.Done()
 
 	// Add the new version data to the index.
 	indexData.Versions = append(indexData.Versions, repo.VersionSummary{Id: versionId, Name: versionName})
+	indexData.VersionInfo[versionId] = meta.Summary()
 
 	// Now write the version data to its file.
-	if verFile, err := os.OpenFile(path.Join(repoDir, fmt.Sprintf("%d.json", versionId)), os.O_CREATE|os.O_EXCL|os.O_WRONLY, fileMode); err != nil {
+	if verFile, err := os.OpenFile(path.Join(repoDir, repoutil.VersionFileName(versionId)), os.O_CREATE|os.O_EXCL|os.O_WRONLY, fileMode); err != nil {
 		var code int
 		var msg string
 		switch {
@@ -290,30 +501,97 @@ func UpdateRepo(repoDir, filesDir, urlBase, newVersionDir, versionName string, v
 			msg = "An unknown error occurred when trying to write the version file."
 			code = -2
 		}
-		return subcmd.CausedError(fmt.Sprintf("Can't update repository %s: %s", repoDir, msg), code, err)
+		return result, subcmd.CausedError(fmt.Sprintf("Can't update repository %s: %s", repoDir, msg), code, err)
 	} else {
 		//jsonData, _ := json.MarshalIndent(versionData, "", "    ")
 		jsonData, _ := json.Marshal(versionData)
 		verFile.Write(jsonData)
+		verFile.Close()
 	}
 
-	// And finally, write the index file.
-	if indexFile, err := os.OpenFile(indexFilePath, os.O_RDWR, fileMode); err != nil {
-		var code int
-		var msg string
-		switch {
-		case os.IsPermission(err):
-			msg = "Can't write index file: permission denied."
-			code = 45
-		default:
-			msg = "An unknown error occurred when trying to write the index file."
-			code = -2
+	// And finally, write the index file. If the index can't be written, remove the version file again so the repository is left as it was.
+	if err := publish.CommitIndex(repoDir, indexData); err != nil {
+		os.Remove(path.Join(repoDir, repoutil.VersionFileName(versionId)))
+		return result, subcmd.WrapError(fmt.Sprintf("Can't update repository %s: %%s", repoDir), err)
+	}
+
+	log.Info("Added version", "repo", repoDir, "id", versionId, "name", versionName, "files", len(versionData.Files), "added", len(result.Added), "reused", result.Reused, "bytes", result.BytesCopied)
+
+	err := publish.Refresh(repoDir, filesDir)
+	result.Change = repoutil.NewChange(repoDir)
+	return result, err
+}
+
+// dryRunUpdate describes what UpdateRepo would do with the files and version it has planned: which files would be transferred to storage, which would be reused, and how the index would change.
+func dryRunUpdate(repoDir string, cfg config.Config, indexData repoutil.Index, versionData repoutil.Version, result Result, reused []fileStorageData) subcmd.Error {
+	repoutil.DryRunf("%s %d files to storage in %s:", cfg.TransferMode, len(result.Added), cfg.FileStorage)
+	for _, file := range result.Added {
+		repoutil.PlanDetail("+ %s -> %s (%s)", file.Path, file.StoragePath, repoutil.FormatSize(file.Size))
+	}
+	repoutil.PlanDetail("Total: %s", repoutil.FormatSize(result.BytesCopied))
+
+	repoutil.DryRunf("reuse %d files already in storage:", len(reused))
+	for _, mapping := range reused {
+		repoutil.PlanDetail("= %s -> %s", mapping.InstallPath, mapping.FileStoragePath)
+	}
+
+	repoutil.DryRunf("write %s with %d files.", repoutil.VersionFileName(versionData.Id), len(versionData.Files))
+
+	// The index can't be validated, since the version file it refers to doesn't exist.
+	indexData.Versions = append(indexData.Versions, repo.VersionSummary{Id: versionData.Id, Name: versionData.Name})
+	indexData.VersionInfo[versionData.Id] = versionData.Summary()
+	repoutil.PrintIndexChanges(repoDir, indexData)
+
+	return publish.Refresh(repoDir, cfg.FileStorage)
+}
+
+// storageURLs returns the URLs that the given files added to storage are published at.
+func storageURLs(urlBase string, files []StoredFile) []string {
+	urls := []string{}
+	for _, file := range files {
+		urls = append(urls, urlBase+file.StoragePath)
+	}
+	return urls
+}
+
+// transferFile gets the file at inPath into file storage at outPath using the given transfer mode. Copies are created with the given mode, and the bytes copied are reported to the given progress.
+func transferFile(transferMode, inPath, outPath string, mode os.FileMode, report *progress.Progress) error {
+	switch transferMode {
+	case config.TransferLink:
+		return os.Link(inPath, outPath)
+	case config.TransferMove:
+		if _, err := os.Stat(outPath); err == nil {
+			return os.ErrExist
 		}
-		return subcmd.CausedError(fmt.Sprintf("Can't update repository %s: %s", repoDir, msg), code, err)
-	} else {
-		jsonData, _ := json.Marshal(indexData)
-		indexFile.Write(jsonData)
+		// Renaming doesn't work across file systems, so fall back to copying and removing the original.
+		err := os.Rename(inPath, outPath)
+		if err == nil {
+			return nil
+		}
+		log.Debug("Couldn't rename file, copying it instead", "path", inPath, "error", err)
+		if err := copyFile(inPath, outPath, mode, report); err != nil {
+			return err
+		}
+		return os.Remove(inPath)
+	default:
+		return copyFile(inPath, outPath, mode, report)
 	}
+}
 
-	return nil
+func copyFile(inPath, outPath string, mode os.FileMode, report *progress.Progress) error {
+	fileIn, err := os.Open(inPath)
+	if err != nil {
+		return err
+	}
+	defer fileIn.Close()
+
+	fileOut, err := os.OpenFile(outPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, mode)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(fileOut, report.Reader(fileIn)); err != nil {
+		fileOut.Close()
+		return err
+	}
+	return fileOut.Close()
 }
@@ -0,0 +1,157 @@
+// Copyright 2013 MultiMC Contributors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package update
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/MultiMC/repoman/config"
+	"github.com/MultiMC/repoman/publish"
+	"github.com/MultiMC/repoman/repoutil"
+	"github.com/MultiMC/repoman/repoutil/repotest"
+)
+
+// newVersionDir returns a directory holding a new version with a single file with the given contents.
+func newVersionDir(t *testing.T, contents string) string {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(path.Join(dir, "a.txt"), []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// testConfig returns a configuration that copies new files into a fresh storage directory.
+func testConfig(t *testing.T) config.Config {
+	return config.Config{FileStorage: t.TempDir(), URLBase: "http://files.example.com/", TransferMode: config.TransferCopy}
+}
+
+func TestAutoVersionId(t *testing.T) {
+	emptyIndex := repotest.Index(nil, nil)
+	repoDir := repotest.Repo(t, &emptyIndex)
+	cfg := testConfig(t)
+
+	for want := 1; want <= 2; want++ {
+		result, err := UpdateRepo(repoDir, cfg, newVersionDir(t, fmt.Sprint(want)), fmt.Sprintf("1.%d", want), AutoVersionId, repoutil.VersionMeta{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result.VersionId != want {
+			t.Errorf("update %d got version ID %d", want, result.VersionId)
+		}
+
+		// Scripts pick the ID up from the text output.
+		output := &bytes.Buffer{}
+		result.PrintText(output)
+		if line := fmt.Sprintf("VERSION_ID=%d\n", want); output.String() != line {
+			t.Errorf("update %d printed %q, want %q", want, output.String(), line)
+		}
+	}
+
+	// Explicit IDs must still be new and above every existing ID.
+	if _, err := UpdateRepo(repoDir, cfg, newVersionDir(t, "x"), "old", 2, repoutil.VersionMeta{}); err == nil || err.ExitCode() != 44 {
+		t.Errorf("reusing version ID 2 returned %v, want exit code 44", err)
+	}
+	if _, err := UpdateRepo(repoDir, cfg, newVersionDir(t, "x"), "older", 0, repoutil.VersionMeta{}); err == nil || err.ExitCode() != repoutil.InvalidIndexExitCode {
+		t.Errorf("adding version ID 0 returned %v, want exit code %d", err, repoutil.InvalidIndexExitCode)
+	}
+}
+
+func TestTransferFile(t *testing.T) {
+	for _, mode := range []string{config.TransferCopy, config.TransferLink, config.TransferMove} {
+		t.Run(mode, func(t *testing.T) {
+			inPath := path.Join(newVersionDir(t, "data"), "a.txt")
+			outPath := path.Join(t.TempDir(), "abcd-a.txt")
+			inInfo, _ := os.Stat(inPath)
+
+			if err := transferFile(mode, inPath, outPath, 0644, nil); err != nil {
+				t.Fatal(err)
+			}
+			if data, err := ioutil.ReadFile(outPath); err != nil || string(data) != "data" {
+				t.Fatalf("stored file has %q, %v", data, err)
+			}
+			outInfo, _ := os.Stat(outPath)
+
+			_, inErr := os.Stat(inPath)
+			switch mode {
+			case config.TransferCopy:
+				if inErr != nil || os.SameFile(inInfo, outInfo) {
+					t.Errorf("the copy isn't a separate file (original: %v)", inErr)
+				}
+			case config.TransferLink:
+				if !os.SameFile(inInfo, outInfo) {
+					t.Error("the stored file isn't a link to the original")
+				}
+			case config.TransferMove:
+				if !os.IsNotExist(inErr) {
+					t.Errorf("the original is still there after moving it (%v)", inErr)
+				}
+			}
+
+			// Files in storage are never overwritten.
+			if err := transferFile(mode, path.Join(newVersionDir(t, "other"), "a.txt"), outPath, 0644, nil); err == nil {
+				t.Error("transferring over an existing file succeeded")
+			}
+			if data, _ := ioutil.ReadFile(outPath); string(data) != "data" {
+				t.Errorf("the stored file was overwritten with %q", data)
+			}
+		})
+	}
+}
+
+// Pre-hooks must see the change before any file is transferred to storage, so that rejecting it leaves storage alone.
+func TestPreHooksRunBeforeTransfer(t *testing.T) {
+	for _, hookStatus := range []int{0, 1} {
+		emptyIndex := repotest.Index(nil, nil)
+		repoDir := repotest.Repo(t, &emptyIndex)
+		cfg := testConfig(t)
+
+		// The hook lists what is in storage when it runs.
+		listing := path.Join(t.TempDir(), "listing")
+		hook := fmt.Sprintf("ls -A '%s' > '%s'; exit %d", cfg.FileStorage, listing, hookStatus)
+		cfgData, _ := json.Marshal(config.Config{PreHooks: []string{hook}})
+		if err := ioutil.WriteFile(path.Join(repoDir, config.FileName), cfgData, 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := UpdateRepo(repoDir, cfg, newVersionDir(t, "data"), "1.0", AutoVersionId, repoutil.VersionMeta{})
+		if listed, readErr := ioutil.ReadFile(listing); readErr != nil || len(listed) > 0 {
+			t.Errorf("hook exiting with %d saw %q in storage (%v), want nothing", hookStatus, listed, readErr)
+		}
+
+		stored, _ := ioutil.ReadDir(cfg.FileStorage)
+		if hookStatus == 0 {
+			if err != nil || len(stored) != 1 {
+				t.Errorf("accepted update returned %v and stored %d files, want 1", err, len(stored))
+			}
+			continue
+		}
+
+		if err == nil || err.ExitCode() != publish.HookVetoExitCode {
+			t.Errorf("rejected update returned %v, want exit code %d", err, publish.HookVetoExitCode)
+		}
+		if len(stored) != 0 {
+			t.Errorf("rejected update stored %d files", len(stored))
+		}
+		if _, statErr := os.Stat(path.Join(repoDir, repoutil.VersionFileName(1))); !os.IsNotExist(statErr) {
+			t.Errorf("rejected update wrote a version file (%v)", statErr)
+		}
+	}
+}